@@ -1,8 +1,14 @@
 package geoclue2
 
-import "encoding/json"
-
-// todo: not implemented
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/godbus/dbus/v5"
+	"github.com/godbus/dbus/v5/introspect"
+	"github.com/godbus/dbus/v5/prop"
+	"sync"
+)
 
 // Paths of methods and properties
 const (
@@ -17,7 +23,8 @@ const (
 	GeoclueAgentPropertyMaxAccuracyLevel = GeoclueAgentInterface + ".MaxAccuracyLevel" // readable   u
 )
 
-// GeoclueAgent interface all application-authorizing agents must implement. There must be a separate agent object for every logged-in user on path "/org/freedesktop/GeoClue2/Agent".
+// GeoclueAgent interface all application-authorizing agents must implement. Use it to talk to an agent
+// exported by another process; see NewGeoclueAgentServer() to implement an agent yourself. There must be a separate agent object for every logged-in user on path "/org/freedesktop/GeoClue2/Agent".
 type GeoclueAgent interface {
 	/* METHODS */
 
@@ -27,27 +34,33 @@ type GeoclueAgent interface {
 	//OUT b authorized: Return value indicating if application should be given location information or not.
 	//OUT u allowed_accuracy_level: The level of location accuracy allowed for client, as GClueAccuracyLevel.
 	AuthorizeApp(string, GClueAccuracyLevel) (bool, GClueAccuracyLevel, error)
+	AuthorizeAppWithContext(ctx context.Context, desktopId string, reqLevel GClueAccuracyLevel) (bool, GClueAccuracyLevel, error)
 
 	/* PROPERTIES */
 	// The global maximum level of accuracy allowed for all clients. Since agents are per-user, this can be different for each user. See GClueAccuracyLevel for possible values.
 	GetMaxAccuracyLevel() (GClueAccuracyLevel, error)
+	GetMaxAccuracyLevelWithContext(ctx context.Context) (GClueAccuracyLevel, error)
 
 	MarshalJSON() ([]byte, error)
 }
 
 // NewGeoclueAgent returns new NewGeoclueAgent Interface
-func NewGeoclueAgent() (GeoclueAgent, error) {
+func NewGeoclueAgent(opts ...Option) (GeoclueAgent, error) {
 	var gca geoclueAgent
-	return &gca, gca.init(GeoclueInterface, GeoclueAgentObjectPath)
+	return &gca, gca.init(GeoclueInterface, GeoclueAgentObjectPath, opts...)
 }
 
 type geoclueAgent struct {
 	dbusBase
 }
 
-func (gca geoclueAgent) AuthorizeApp(desktopId string, reqLevel GClueAccuracyLevel) (authorized bool, allowedLevel GClueAccuracyLevel, err error) {
+func (gca *geoclueAgent) AuthorizeApp(desktopId string, reqLevel GClueAccuracyLevel) (bool, GClueAccuracyLevel, error) {
+	return gca.AuthorizeAppWithContext(context.Background(), desktopId, reqLevel)
+}
+
+func (gca *geoclueAgent) AuthorizeAppWithContext(ctx context.Context, desktopId string, reqLevel GClueAccuracyLevel) (authorized bool, allowedLevel GClueAccuracyLevel, err error) {
 	var tmpUint uint32
-	err = gca.callWithReturn2(&authorized, &tmpUint, GeoclueAgentAuthorizeApp, &desktopId, &reqLevel)
+	err = gca.callWithReturn2(ctx, &authorized, &tmpUint, GeoclueAgentAuthorizeApp, &desktopId, &reqLevel)
 	if err != nil {
 		return false, GClueAccuracyLevelNone, err
 	}
@@ -55,15 +68,19 @@ func (gca geoclueAgent) AuthorizeApp(desktopId string, reqLevel GClueAccuracyLev
 	return
 }
 
-func (gca geoclueAgent) GetMaxAccuracyLevel() (GClueAccuracyLevel, error) {
-	res, err := gca.getUint32Property(GeoclueAgentPropertyMaxAccuracyLevel)
+func (gca *geoclueAgent) GetMaxAccuracyLevel() (GClueAccuracyLevel, error) {
+	return gca.GetMaxAccuracyLevelWithContext(context.Background())
+}
+
+func (gca *geoclueAgent) GetMaxAccuracyLevelWithContext(ctx context.Context) (GClueAccuracyLevel, error) {
+	res, err := gca.getUint32Property(ctx, GeoclueAgentPropertyMaxAccuracyLevel)
 	if err != nil {
 		return GClueAccuracyLevelNone, err
 	}
 	return GClueAccuracyLevel(res), nil
 }
 
-func (gca geoclueAgent) MarshalJSON() ([]byte, error) {
+func (gca *geoclueAgent) MarshalJSON() ([]byte, error) {
 	maxAccuracyLevel, err := gca.GetMaxAccuracyLevel()
 	if err != nil {
 		return nil, err
@@ -72,3 +89,147 @@ func (gca geoclueAgent) MarshalJSON() ([]byte, error) {
 		"MaxAccuracyLevel": maxAccuracyLevel,
 	})
 }
+
+// AuthorizeAppFunc is an adapter to use an ordinary function as AuthorizationPolicy.
+type AuthorizeAppFunc func(desktopId string, reqLevel GClueAccuracyLevel) (authorized bool, allowedLevel GClueAccuracyLevel)
+
+// GeoclueAgentServer is an application-authorizing agent exported on "/org/freedesktop/GeoClue2/Agent".
+// Geoclue calls its AuthorizeApp method whenever a client of the agent's user is started.
+type GeoclueAgentServer interface {
+	// The desktop id the agent registered itself with.
+	GetId() string
+
+	// The global maximum level of accuracy allowed for all clients. Levels returned by the AuthorizationPolicy
+	// are capped to this level. The default is GClueAccuracyLevelExact.
+	GetMaxAccuracyLevel() GClueAccuracyLevel
+	// Sets the maximum level of accuracy and notifies geoclue about the change.
+	SetMaxAccuracyLevel(level GClueAccuracyLevel) error
+
+	// Unexports the agent. Geoclue forgets about the agent once the D-Bus connection is closed.
+	Close() error
+}
+
+// NewGeoclueAgentServer exports an agent on the D-Bus connection and registers it at the manager with AddAgent(id).
+// The id is the desktop id of the agent and must be allowed in the [agent] whitelist of geoclue.conf.
+// AuthorizeApp calls are answered by the policy, calls from any other peer than the GeoClue2 service are rejected.
+func NewGeoclueAgentServer(id string, policy AuthorizationPolicy, opts ...Option) (GeoclueAgentServer, error) {
+	return NewGeoclueAgentServerWithContext(context.Background(), id, policy, opts...)
+}
+
+// NewGeoclueAgentServerWithContext is like NewGeoclueAgentServer() but uses ctx for the registration at the manager.
+func NewGeoclueAgentServerWithContext(ctx context.Context, id string, policy AuthorizationPolicy, opts ...Option) (GeoclueAgentServer, error) {
+	if policy == nil {
+		return nil, errors.New("policy must not be nil")
+	}
+	gcm, err := NewGeoclueManager(opts...)
+	if err != nil {
+		return nil, err
+	}
+	conn := gcm.(*geoclueManager).conn
+	gas := &geoclueAgentServer{id: id, conn: conn, policy: policy}
+
+	gas.props, err = prop.Export(conn, GeoclueAgentObjectPath, map[string]map[string]*prop.Prop{
+		GeoclueAgentInterface: {
+			"MaxAccuracyLevel": {Value: uint32(GClueAccuracyLevelExact), Emit: prop.EmitTrue},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = conn.ExportMethodTable(map[string]interface{}{
+		"AuthorizeApp": gas.authorizeApp,
+	}, GeoclueAgentObjectPath, GeoclueAgentInterface)
+	if err != nil {
+		gas.Close()
+		return nil, err
+	}
+	node := &introspect.Node{
+		Name: GeoclueAgentObjectPath,
+		Interfaces: []introspect.Interface{
+			introspect.IntrospectData,
+			prop.IntrospectData,
+			{
+				Name: GeoclueAgentInterface,
+				Methods: []introspect.Method{{
+					Name: "AuthorizeApp",
+					Args: []introspect.Arg{
+						{Name: "desktop_id", Type: "s", Direction: "in"},
+						{Name: "req_accuracy_level", Type: "u", Direction: "in"},
+						{Name: "authorized", Type: "b", Direction: "out"},
+						{Name: "allowed_accuracy_level", Type: "u", Direction: "out"},
+					},
+				}},
+				Properties: gas.props.Introspection(GeoclueAgentInterface),
+			},
+		},
+	}
+	err = conn.Export(introspect.NewIntrospectable(node), GeoclueAgentObjectPath, dbusIntrospectableInterface)
+	if err != nil {
+		gas.Close()
+		return nil, err
+	}
+
+	err = gcm.AddAgentWithContext(ctx, id)
+	if err != nil {
+		gas.Close()
+		return nil, err
+	}
+	return gas, nil
+}
+
+type geoclueAgentServer struct {
+	id     string
+	conn   *dbus.Conn
+	props  *prop.Properties
+	mu     sync.Mutex
+	closed bool
+	policy AuthorizationPolicy
+}
+
+func (gas *geoclueAgentServer) GetId() string {
+	return gas.id
+}
+
+func (gas *geoclueAgentServer) GetMaxAccuracyLevel() GClueAccuracyLevel {
+	return GClueAccuracyLevel(gas.props.GetMust(GeoclueAgentInterface, "MaxAccuracyLevel").(uint32))
+}
+
+func (gas *geoclueAgentServer) SetMaxAccuracyLevel(level GClueAccuracyLevel) error {
+	gas.mu.Lock()
+	defer gas.mu.Unlock()
+	if gas.closed {
+		return errors.New("agent is closed")
+	}
+	gas.props.SetMust(GeoclueAgentInterface, "MaxAccuracyLevel", uint32(level))
+	return nil
+}
+
+func (gas *geoclueAgentServer) Close() error {
+	gas.mu.Lock()
+	defer gas.mu.Unlock()
+	gas.closed = true
+	for _, iface := range []string{GeoclueAgentInterface, dbusPropertiesInterface, dbusIntrospectableInterface} {
+		err := gas.conn.Export(nil, GeoclueAgentObjectPath, iface)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (gas *geoclueAgentServer) authorizeApp(sender dbus.Sender, desktopId string, reqLevel uint32) (bool, uint32, *dbus.Error) {
+	var owner string
+	err := gas.conn.BusObject().Call(dbusMethodGetNameOwner, 0, GeoclueInterface).Store(&owner)
+	if err != nil || owner != string(sender) {
+		return false, 0, dbus.NewError(DBusErrorAccessDenied, []interface{}{"AuthorizeApp is only allowed for " + GeoclueInterface})
+	}
+
+	authorized, allowedLevel := gas.policy.AuthorizeApp(desktopId, GClueAccuracyLevel(reqLevel))
+	if !authorized {
+		return false, uint32(GClueAccuracyLevelNone), nil
+	}
+	if maxLevel := gas.GetMaxAccuracyLevel(); allowedLevel > maxLevel {
+		allowedLevel = maxLevel
+	}
+	return true, uint32(allowedLevel), nil
+}
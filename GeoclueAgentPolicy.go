@@ -0,0 +1,390 @@
+package geoclue2
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/BurntSushi/toml"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AuthorizationPolicy decides whether the application with the given desktop id should be given location
+// information and with which accuracy level. It is used by a GeoclueAgentServer to answer AuthorizeApp calls.
+type AuthorizationPolicy interface {
+	AuthorizeApp(desktopId string, reqLevel GClueAccuracyLevel) (authorized bool, allowedLevel GClueAccuracyLevel)
+}
+
+// PolicyMatcher is implemented by policies which only apply to some applications.
+// A PolicyChain skips policies which do not match the request.
+type PolicyMatcher interface {
+	Matches(desktopId string, reqLevel GClueAccuracyLevel) bool
+}
+
+// AuthorizeApp calls f(desktopId, reqLevel).
+func (f AuthorizeAppFunc) AuthorizeApp(desktopId string, reqLevel GClueAccuracyLevel) (bool, GClueAccuracyLevel) {
+	return f(desktopId, reqLevel)
+}
+
+// Policies allowing or denying all applications
+var (
+	AllowAll AuthorizationPolicy = AuthorizeAppFunc(func(desktopId string, reqLevel GClueAccuracyLevel) (bool, GClueAccuracyLevel) {
+		return true, reqLevel
+	})
+	DenyAll AuthorizationPolicy = AuthorizeAppFunc(func(desktopId string, reqLevel GClueAccuracyLevel) (bool, GClueAccuracyLevel) {
+		return false, GClueAccuracyLevelNone
+	})
+)
+
+func containsDesktopId(desktopIds []string, desktopId string) bool {
+	for _, id := range desktopIds {
+		if id == desktopId {
+			return true
+		}
+	}
+	return false
+}
+
+func minLevel(a, b GClueAccuracyLevel) GClueAccuracyLevel {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// AllowList authorizes the listed applications and denies all others.
+// In a PolicyChain it only matches the listed applications.
+type AllowList struct {
+	DesktopIds []string
+	// Caps the allowed accuracy level, GClueAccuracyLevelNone means no cap.
+	MaxAccuracyLevel GClueAccuracyLevel
+}
+
+func (p AllowList) Matches(desktopId string, reqLevel GClueAccuracyLevel) bool {
+	return containsDesktopId(p.DesktopIds, desktopId)
+}
+
+func (p AllowList) AuthorizeApp(desktopId string, reqLevel GClueAccuracyLevel) (bool, GClueAccuracyLevel) {
+	if !containsDesktopId(p.DesktopIds, desktopId) {
+		return false, GClueAccuracyLevelNone
+	}
+	if p.MaxAccuracyLevel != GClueAccuracyLevelNone {
+		return true, minLevel(reqLevel, p.MaxAccuracyLevel)
+	}
+	return true, reqLevel
+}
+
+// DenyList denies the listed applications and authorizes all others.
+// In a PolicyChain it only matches the listed applications.
+type DenyList struct {
+	DesktopIds []string
+}
+
+func (p DenyList) Matches(desktopId string, reqLevel GClueAccuracyLevel) bool {
+	return containsDesktopId(p.DesktopIds, desktopId)
+}
+
+func (p DenyList) AuthorizeApp(desktopId string, reqLevel GClueAccuracyLevel) (bool, GClueAccuracyLevel) {
+	if containsDesktopId(p.DesktopIds, desktopId) {
+		return false, GClueAccuracyLevelNone
+	}
+	return true, reqLevel
+}
+
+// AccuracyCap authorizes all applications, but caps the accuracy level per desktop id.
+// In a PolicyChain it only matches the applications with a cap.
+type AccuracyCap struct {
+	Levels map[string]GClueAccuracyLevel
+}
+
+func (p AccuracyCap) Matches(desktopId string, reqLevel GClueAccuracyLevel) bool {
+	_, ok := p.Levels[desktopId]
+	return ok
+}
+
+func (p AccuracyCap) AuthorizeApp(desktopId string, reqLevel GClueAccuracyLevel) (bool, GClueAccuracyLevel) {
+	if level, ok := p.Levels[desktopId]; ok {
+		return true, minLevel(reqLevel, level)
+	}
+	return true, reqLevel
+}
+
+// TimeWindow authorizes applications only between From and To (local time of day, e.g. 8*time.Hour).
+// If To is before From, the window spans midnight. Within the window the decision is delegated to Policy,
+// or the requested level is allowed if Policy is nil.
+// In a PolicyChain it matches the listed applications, or all applications if DesktopIds is empty.
+type TimeWindow struct {
+	DesktopIds []string
+	From       time.Duration
+	To         time.Duration
+	Policy     AuthorizationPolicy
+}
+
+func (p TimeWindow) Matches(desktopId string, reqLevel GClueAccuracyLevel) bool {
+	return len(p.DesktopIds) == 0 || containsDesktopId(p.DesktopIds, desktopId)
+}
+
+func (p TimeWindow) AuthorizeApp(desktopId string, reqLevel GClueAccuracyLevel) (bool, GClueAccuracyLevel) {
+	if !p.contains(time.Now()) {
+		return false, GClueAccuracyLevelNone
+	}
+	if p.Policy != nil {
+		return p.Policy.AuthorizeApp(desktopId, reqLevel)
+	}
+	return true, reqLevel
+}
+
+func (p TimeWindow) contains(t time.Time) bool {
+	// the time on the clock, not the time elapsed since midnight, which differs on DST change days
+	d := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute + time.Duration(t.Second())*time.Second
+	if p.From <= p.To {
+		return d >= p.From && d < p.To
+	}
+	return d >= p.From || d < p.To
+}
+
+// PolicyChain asks the first policy matching the request. Policies not implementing PolicyMatcher always match.
+// If no policy matches, the Default policy decides, or the application is denied if Default is nil.
+type PolicyChain struct {
+	Policies []AuthorizationPolicy
+	Default  AuthorizationPolicy
+}
+
+func (p PolicyChain) AuthorizeApp(desktopId string, reqLevel GClueAccuracyLevel) (bool, GClueAccuracyLevel) {
+	for _, policy := range p.Policies {
+		if m, ok := policy.(PolicyMatcher); ok && !m.Matches(desktopId, reqLevel) {
+			continue
+		}
+		return policy.AuthorizeApp(desktopId, reqLevel)
+	}
+	if p.Default != nil {
+		return p.Default.AuthorizeApp(desktopId, reqLevel)
+	}
+	return false, GClueAccuracyLevelNone
+}
+
+// policyConfig is the JSON or TOML representation of a PolicyChain:
+//
+//	{
+//	  "default": "deny",
+//	  "rules": [
+//	    {"type": "deny", "desktop_ids": ["untrusted-app"]},
+//	    {"type": "allow", "desktop_ids": ["firefox"], "max_accuracy_level": "city"},
+//	    {"type": "cap", "desktop_ids": ["weather"], "max_accuracy_level": "country"},
+//	    {"type": "time_window", "desktop_ids": ["fleet-tracker"], "from": "08:00", "to": "18:00"}
+//	  ]
+//	}
+//
+// or
+//
+//	default = "deny"
+//
+//	[[rules]]
+//	type = "deny"
+//	desktop_ids = ["untrusted-app"]
+//
+//	[[rules]]
+//	type = "time_window"
+//	desktop_ids = ["fleet-tracker"]
+//	from = "08:00"
+//	to = "18:00"
+type policyConfig struct {
+	Default string             `json:"default" toml:"default"`
+	Rules   []policyRuleConfig `json:"rules" toml:"rules"`
+}
+
+type policyRuleConfig struct {
+	Type             string   `json:"type" toml:"type"`
+	DesktopIds       []string `json:"desktop_ids" toml:"desktop_ids"`
+	MaxAccuracyLevel string   `json:"max_accuracy_level" toml:"max_accuracy_level"`
+	From             string   `json:"from" toml:"from"`
+	To               string   `json:"to" toml:"to"`
+}
+
+// ParsePolicy reads a PolicyChain in JSON format. Each rule has a type ("allow", "deny", "cap" or "time_window"),
+// a list of desktop_ids and optionally a max_accuracy_level (name or number). Time windows take "from" and "to"
+// in "15:04" format. The default ("allow" or "deny") applies if no rule matches and defaults to "deny".
+func ParsePolicy(r io.Reader) (AuthorizationPolicy, error) {
+	var config policyConfig
+	decoder := json.NewDecoder(r)
+	decoder.DisallowUnknownFields()
+	err := decoder.Decode(&config)
+	if err != nil {
+		return nil, err
+	}
+	return config.chain()
+}
+
+// ParsePolicyTOML is like ParsePolicy() but reads the policy in TOML format, with a [[rules]] table per rule.
+func ParsePolicyTOML(r io.Reader) (AuthorizationPolicy, error) {
+	var config policyConfig
+	md, err := toml.NewDecoder(r).Decode(&config)
+	if err != nil {
+		return nil, err
+	}
+	if undecoded := md.Undecoded(); len(undecoded) > 0 {
+		return nil, fmt.Errorf("unknown field '%s'", undecoded[0])
+	}
+	return config.chain()
+}
+
+func (config policyConfig) chain() (AuthorizationPolicy, error) {
+	var chain PolicyChain
+	switch config.Default {
+	case "", "deny":
+		chain.Default = DenyAll
+	case "allow":
+		chain.Default = AllowAll
+	default:
+		return nil, fmt.Errorf("invalid default policy '%s'", config.Default)
+	}
+	for idx, rule := range config.Rules {
+		policy, err := rule.policy()
+		if err != nil {
+			return nil, fmt.Errorf("rule %d: %v", idx, err)
+		}
+		chain.Policies = append(chain.Policies, policy)
+	}
+	return chain, nil
+}
+
+func (rule policyRuleConfig) policy() (AuthorizationPolicy, error) {
+	var level GClueAccuracyLevel
+	if rule.MaxAccuracyLevel != "" {
+		var err error
+		level, err = ParseGClueAccuracyLevel(rule.MaxAccuracyLevel)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if rule.Type != "time_window" && len(rule.DesktopIds) == 0 {
+		return nil, fmt.Errorf("%s rule without desktop_ids", rule.Type)
+	}
+
+	switch rule.Type {
+	case "allow":
+		return AllowList{DesktopIds: rule.DesktopIds, MaxAccuracyLevel: level}, nil
+	case "deny":
+		return DenyList{DesktopIds: rule.DesktopIds}, nil
+	case "cap":
+		if rule.MaxAccuracyLevel == "" {
+			return nil, fmt.Errorf("cap rule without max_accuracy_level")
+		}
+		levels := make(map[string]GClueAccuracyLevel, len(rule.DesktopIds))
+		for _, id := range rule.DesktopIds {
+			levels[id] = level
+		}
+		return AccuracyCap{Levels: levels}, nil
+	case "time_window":
+		from, err := parseTimeOfDay(rule.From)
+		if err != nil {
+			return nil, err
+		}
+		to, err := parseTimeOfDay(rule.To)
+		if err != nil {
+			return nil, err
+		}
+		window := TimeWindow{DesktopIds: rule.DesktopIds, From: from, To: to}
+		if level != GClueAccuracyLevelNone {
+			window.Policy = AuthorizeAppFunc(func(desktopId string, reqLevel GClueAccuracyLevel) (bool, GClueAccuracyLevel) {
+				return true, minLevel(reqLevel, level)
+			})
+		}
+		return window, nil
+	default:
+		return nil, fmt.Errorf("invalid rule type '%s'", rule.Type)
+	}
+}
+
+func parseTimeOfDay(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day '%s'", s)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// PolicyFile is an AuthorizationPolicy loaded from a JSON file (see ParsePolicy()) or, if the file name ends
+// with ".toml", from a TOML file (see ParsePolicyTOML()). It can be reloaded while the agent is running.
+// It is safe for concurrent use.
+type PolicyFile struct {
+	path string
+
+	mu      sync.RWMutex
+	policy  AuthorizationPolicy
+	modTime time.Time
+}
+
+// LoadPolicyFile loads the policy from the JSON or TOML file at path.
+func LoadPolicyFile(path string) (*PolicyFile, error) {
+	p := &PolicyFile{path: path}
+	err := p.Reload()
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *PolicyFile) AuthorizeApp(desktopId string, reqLevel GClueAccuracyLevel) (bool, GClueAccuracyLevel) {
+	p.mu.RLock()
+	policy := p.policy
+	p.mu.RUnlock()
+	return policy.AuthorizeApp(desktopId, reqLevel)
+}
+
+// Reload reads the file again. If the file can't be read or parsed, the previous policy stays in place.
+func (p *PolicyFile) Reload() error {
+	f, err := os.Open(p.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	parse := ParsePolicy
+	if strings.HasSuffix(p.path, ".toml") {
+		parse = ParsePolicyTOML
+	}
+	policy, err := parse(f)
+	if err != nil {
+		return fmt.Errorf("%s: %v", p.path, err)
+	}
+
+	p.mu.Lock()
+	p.policy = policy
+	p.modTime = info.ModTime()
+	p.mu.Unlock()
+	return nil
+}
+
+// Watch checks the modification time of the file every interval and reloads it on change, until ctx is done.
+// Reload errors are passed to onError, if not nil.
+func (p *PolicyFile) Watch(ctx context.Context, interval time.Duration, onError func(error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			info, err := os.Stat(p.path)
+			if err == nil {
+				p.mu.RLock()
+				changed := !info.ModTime().Equal(p.modTime)
+				p.mu.RUnlock()
+				if !changed {
+					continue
+				}
+				err = p.Reload()
+			}
+			if err != nil && onError != nil {
+				onError(err)
+			}
+		}
+	}
+}
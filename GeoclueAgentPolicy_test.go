@@ -0,0 +1,277 @@
+package geoclue2
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTimeWindowContains(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skip(err)
+	}
+	office := TimeWindow{From: 8 * time.Hour, To: 18 * time.Hour}
+	night := TimeWindow{From: 22 * time.Hour, To: 6 * time.Hour}
+	tests := []struct {
+		window TimeWindow
+		t      time.Time
+		want   bool
+	}{
+		{office, time.Date(2020, 9, 14, 7, 59, 59, 0, berlin), false},
+		{office, time.Date(2020, 9, 14, 8, 0, 0, 0, berlin), true},
+		{office, time.Date(2020, 9, 14, 17, 59, 59, 0, berlin), true},
+		{office, time.Date(2020, 9, 14, 18, 0, 0, 0, berlin), false},
+		// the window spans midnight
+		{night, time.Date(2020, 9, 14, 21, 59, 0, 0, berlin), false},
+		{night, time.Date(2020, 9, 14, 22, 0, 0, 0, berlin), true},
+		{night, time.Date(2020, 9, 14, 23, 59, 59, 0, berlin), true},
+		{night, time.Date(2020, 9, 15, 0, 0, 0, 0, berlin), true},
+		{night, time.Date(2020, 9, 15, 5, 59, 59, 0, berlin), true},
+		{night, time.Date(2020, 9, 15, 6, 0, 0, 0, berlin), false},
+		// on DST change days the clock differs from the time elapsed since midnight by an hour
+		{office, time.Date(2020, 3, 29, 7, 30, 0, 0, berlin), false},
+		{office, time.Date(2020, 3, 29, 8, 30, 0, 0, berlin), true},
+		{office, time.Date(2020, 3, 29, 17, 30, 0, 0, berlin), true},
+		{office, time.Date(2020, 10, 25, 7, 30, 0, 0, berlin), false},
+		{office, time.Date(2020, 10, 25, 17, 30, 0, 0, berlin), true},
+		{office, time.Date(2020, 10, 25, 18, 30, 0, 0, berlin), false},
+	}
+	for _, test := range tests {
+		if got := test.window.contains(test.t); got != test.want {
+			t.Errorf("%v-%v contains %v = %v, want %v", test.window.From, test.window.To, test.t, got, test.want)
+		}
+	}
+}
+
+func TestPolicies(t *testing.T) {
+	chain := PolicyChain{
+		Policies: []AuthorizationPolicy{
+			DenyList{DesktopIds: []string{"untrusted"}},
+			AllowList{DesktopIds: []string{"maps", "untrusted"}, MaxAccuracyLevel: GClueAccuracyLevelStreet},
+			AccuracyCap{Levels: map[string]GClueAccuracyLevel{"weather": GClueAccuracyLevelCity}},
+			// never asked, maps matches the allow list above first
+			AllowList{DesktopIds: []string{"maps"}},
+		},
+	}
+	withDefault := chain
+	withDefault.Default = AuthorizeAppFunc(func(desktopId string, reqLevel GClueAccuracyLevel) (bool, GClueAccuracyLevel) {
+		return true, GClueAccuracyLevelCountry
+	})
+	tests := []struct {
+		name       string
+		policy     AuthorizationPolicy
+		desktopId  string
+		reqLevel   GClueAccuracyLevel
+		authorized bool
+		level      GClueAccuracyLevel
+	}{
+		{"allow all", AllowAll, "maps", GClueAccuracyLevelExact, true, GClueAccuracyLevelExact},
+		{"deny all", DenyAll, "maps", GClueAccuracyLevelExact, false, GClueAccuracyLevelNone},
+		{"allow list", AllowList{DesktopIds: []string{"maps"}}, "maps", GClueAccuracyLevelExact, true, GClueAccuracyLevelExact},
+		{"allow list other", AllowList{DesktopIds: []string{"maps"}}, "weather", GClueAccuracyLevelExact, false, GClueAccuracyLevelNone},
+		{"allow list capped", AllowList{DesktopIds: []string{"maps"}, MaxAccuracyLevel: GClueAccuracyLevelCity}, "maps", GClueAccuracyLevelExact, true, GClueAccuracyLevelCity},
+		{"allow list below cap", AllowList{DesktopIds: []string{"maps"}, MaxAccuracyLevel: GClueAccuracyLevelCity}, "maps", GClueAccuracyLevelCountry, true, GClueAccuracyLevelCountry},
+		{"deny list", DenyList{DesktopIds: []string{"untrusted"}}, "untrusted", GClueAccuracyLevelExact, false, GClueAccuracyLevelNone},
+		{"deny list other", DenyList{DesktopIds: []string{"untrusted"}}, "maps", GClueAccuracyLevelExact, true, GClueAccuracyLevelExact},
+		{"cap", AccuracyCap{Levels: map[string]GClueAccuracyLevel{"weather": GClueAccuracyLevelCity}}, "weather", GClueAccuracyLevelExact, true, GClueAccuracyLevelCity},
+		{"cap below", AccuracyCap{Levels: map[string]GClueAccuracyLevel{"weather": GClueAccuracyLevelCity}}, "weather", GClueAccuracyLevelCountry, true, GClueAccuracyLevelCountry},
+		{"cap other", AccuracyCap{Levels: map[string]GClueAccuracyLevel{"weather": GClueAccuracyLevelCity}}, "maps", GClueAccuracyLevelExact, true, GClueAccuracyLevelExact},
+		{"chain first match", chain, "untrusted", GClueAccuracyLevelExact, false, GClueAccuracyLevelNone},
+		{"chain second match", chain, "maps", GClueAccuracyLevelExact, true, GClueAccuracyLevelStreet},
+		{"chain third match", chain, "weather", GClueAccuracyLevelExact, true, GClueAccuracyLevelCity},
+		{"chain no match", chain, "other", GClueAccuracyLevelExact, false, GClueAccuracyLevelNone},
+		{"chain default", withDefault, "other", GClueAccuracyLevelExact, true, GClueAccuracyLevelCountry},
+		{"chain default not used", withDefault, "weather", GClueAccuracyLevelExact, true, GClueAccuracyLevelCity},
+		{"empty chain", PolicyChain{}, "maps", GClueAccuracyLevelExact, false, GClueAccuracyLevelNone},
+		{"always open window", TimeWindow{From: 0, To: 24 * time.Hour, Policy: DenyList{DesktopIds: []string{"untrusted"}}}, "untrusted", GClueAccuracyLevelExact, false, GClueAccuracyLevelNone},
+		{"never open window", TimeWindow{From: 0, To: 0}, "maps", GClueAccuracyLevelExact, false, GClueAccuracyLevelNone},
+		{"chain window", PolicyChain{Policies: []AuthorizationPolicy{TimeWindow{DesktopIds: []string{"tracker"}}}, Default: AllowAll}, "maps", GClueAccuracyLevelExact, true, GClueAccuracyLevelExact},
+	}
+	for _, test := range tests {
+		authorized, level := test.policy.AuthorizeApp(test.desktopId, test.reqLevel)
+		if authorized != test.authorized || level != test.level {
+			t.Errorf("%s: AuthorizeApp(%s, %v) = %v, %v, want %v, %v",
+				test.name, test.desktopId, test.reqLevel, authorized, level, test.authorized, test.level)
+		}
+	}
+}
+
+const testPolicyJSON = `{
+  "default": "allow",
+  "rules": [
+    {"type": "deny", "desktop_ids": ["untrusted"]},
+    {"type": "allow", "desktop_ids": ["maps"], "max_accuracy_level": "street"},
+    {"type": "cap", "desktop_ids": ["weather"], "max_accuracy_level": "4"},
+    {"type": "time_window", "desktop_ids": ["tracker"], "from": "08:00", "to": "18:30"}
+  ]
+}`
+
+const testPolicyTOML = `default = "allow"
+
+[[rules]]
+type = "deny"
+desktop_ids = ["untrusted"]
+
+[[rules]]
+type = "allow"
+desktop_ids = ["maps"]
+max_accuracy_level = "street"
+
+[[rules]]
+type = "cap"
+desktop_ids = ["weather"]
+max_accuracy_level = "4"
+
+[[rules]]
+type = "time_window"
+desktop_ids = ["tracker"]
+from = "08:00"
+to = "18:30"
+`
+
+func TestParsePolicy(t *testing.T) {
+	want := []AuthorizationPolicy{
+		DenyList{DesktopIds: []string{"untrusted"}},
+		AllowList{DesktopIds: []string{"maps"}, MaxAccuracyLevel: GClueAccuracyLevelStreet},
+		AccuracyCap{Levels: map[string]GClueAccuracyLevel{"weather": GClueAccuracyLevelCity}},
+		TimeWindow{DesktopIds: []string{"tracker"}, From: 8 * time.Hour, To: 18*time.Hour + 30*time.Minute},
+	}
+	parsers := map[string]func(io.Reader) (AuthorizationPolicy, error){
+		"JSON": ParsePolicy,
+		"TOML": ParsePolicyTOML,
+	}
+	inputs := map[string]string{
+		"JSON": testPolicyJSON,
+		"TOML": testPolicyTOML,
+	}
+	for format, parse := range parsers {
+		policy, err := parse(strings.NewReader(inputs[format]))
+		if err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		chain, ok := policy.(PolicyChain)
+		if !ok {
+			t.Fatalf("%s: %T, want PolicyChain", format, policy)
+		}
+		if !reflect.DeepEqual(chain.Policies, want) {
+			t.Errorf("%s: policies %+v, want %+v", format, chain.Policies, want)
+		}
+		if authorized, _ := chain.AuthorizeApp("other", GClueAccuracyLevelExact); !authorized {
+			t.Errorf("%s: other application denied, want the default allow", format)
+		}
+	}
+
+	invalid := []struct {
+		format string
+		input  string
+	}{
+		{"JSON", `{"default": "maybe"}`},
+		{"JSON", `{"rules": [{"type": "allow"}]}`},
+		{"JSON", `{"rules": [{"type": "cap", "desktop_ids": ["maps"]}]}`},
+		{"JSON", `{"rules": [{"type": "allow", "desktop_ids": ["maps"], "max_accuracy_level": "high"}]}`},
+		{"JSON", `{"rules": [{"type": "time_window", "from": "8", "to": "18:00"}]}`},
+		{"JSON", `{"rules": [{"type": "grant", "desktop_ids": ["maps"]}]}`},
+		{"JSON", `{"rules": [{"type": "allow", "desktop_id": ["maps"]}]}`},
+		{"JSON", `{"default": "allow"`},
+		{"TOML", `default = "maybe"`},
+		{"TOML", "[[rules]]\ntype = \"allow\"\ndesktop_id = [\"maps\"]"},
+		{"TOML", "[[rules]]\ntype = \"allow\"\ndesktop_ids = \"maps\""},
+		{"TOML", `default = allow`},
+	}
+	for _, test := range invalid {
+		if _, err := parsers[test.format](strings.NewReader(test.input)); err == nil {
+			t.Errorf("%s policy %s parsed without error", test.format, test.input)
+		}
+	}
+}
+
+func TestPolicyFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "policy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "policy.toml")
+	write := func(content string, modTime time.Time) {
+		t.Helper()
+		if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	authorized := func(p *PolicyFile) bool {
+		authorized, _ := p.AuthorizeApp("maps", GClueAccuracyLevelExact)
+		return authorized
+	}
+	modTime := time.Now().Add(-time.Hour)
+	write(`default = "deny"`, modTime)
+
+	p, err := LoadPolicyFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if authorized(p) {
+		t.Fatal("application authorized by the default deny")
+	}
+	write(`default = "allow"`, modTime)
+	if err := p.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if !authorized(p) {
+		t.Fatal("application denied after Reload()")
+	}
+	// the previous policy stays in place if the file is invalid
+	write(`default = `, modTime)
+	if err := p.Reload(); err == nil {
+		t.Fatal("Reload() of an invalid file succeeded")
+	}
+	if !authorized(p) {
+		t.Fatal("application denied after a failed Reload()")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errs := make(chan error, 10)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		p.Watch(ctx, 10*time.Millisecond, func(err error) { errs <- err })
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+	wait := func(want bool) {
+		t.Helper()
+		for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+			if authorized(p) == want {
+				return
+			}
+		}
+		t.Fatalf("authorized %v after the change of the file, want %v", !want, want)
+	}
+	write(`default = "deny"`, modTime.Add(time.Minute))
+	wait(false)
+	write(`default = "allow"`, modTime.Add(2*time.Minute))
+	wait(true)
+	write(`default = `, modTime.Add(3*time.Minute))
+	select {
+	case err := <-errs:
+		if !strings.Contains(err.Error(), path) {
+			t.Errorf("error %v does not name the file", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no error for the invalid file")
+	}
+	if !authorized(p) {
+		t.Error("application denied after loading an invalid file")
+	}
+}
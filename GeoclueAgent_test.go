@@ -0,0 +1,89 @@
+package geoclue2_test
+
+import (
+	"errors"
+	"github.com/godbus/dbus/v5"
+	"github.com/maltegrosse/go-geoclue2"
+	"testing"
+)
+
+func TestAgentServer(t *testing.T) {
+	f := newFake(t)
+	defer f.close()
+
+	agentConn := f.dial(t)
+	policy := geoclue2.PolicyChain{
+		Policies: []geoclue2.AuthorizationPolicy{
+			geoclue2.DenyList{DesktopIds: []string{"untrusted"}},
+			geoclue2.AccuracyCap{Levels: map[string]geoclue2.GClueAccuracyLevel{"weather": geoclue2.GClueAccuracyLevelCity}},
+		},
+		Default: geoclue2.AllowAll,
+	}
+	gas, err := geoclue2.NewGeoclueAgentServer("agent", policy, geoclue2.WithConn(agentConn))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer gas.Close()
+	if id := f.srv.Agents()[agentConn.Names()[0]]; id != "agent" {
+		t.Fatalf("agents %v, want the agent registered as 'agent'", f.srv.Agents())
+	}
+
+	// the service asks the agent whenever a client is started
+	gcm := f.manager(t)
+	untrusted := newClient(t, gcm, "untrusted")
+	if err := untrusted.Start(); !errors.Is(err, geoclue2.ErrAccessDenied) {
+		t.Errorf("Start() of a denied application = %v, want ErrAccessDenied", err)
+	}
+	weather := newClient(t, gcm, "weather")
+	if err := weather.Start(); err != nil {
+		t.Fatal(err)
+	}
+	if state, _ := f.srv.Client(weather.ObjectPath()); state.AllowedAccuracyLevel != geoclue2.GClueAccuracyLevelCity {
+		t.Errorf("allowed accuracy level %v, want %v", state.AllowedAccuracyLevel, geoclue2.GClueAccuracyLevelCity)
+	}
+
+	// the agent caps the levels of the policy to MaxAccuracyLevel itself
+	if err := gas.SetMaxAccuracyLevel(geoclue2.GClueAccuracyLevelStreet); err != nil {
+		t.Fatal(err)
+	}
+	if level := gas.GetMaxAccuracyLevel(); level != geoclue2.GClueAccuracyLevelStreet {
+		t.Errorf("GetMaxAccuracyLevel() = %v, want %v", level, geoclue2.GClueAccuracyLevelStreet)
+	}
+	authorizeApp := func(conn *dbus.Conn, desktopId string) (bool, geoclue2.GClueAccuracyLevel, error) {
+		var authorized bool
+		var level uint32
+		err := conn.Object(agentConn.Names()[0], geoclue2.GeoclueAgentObjectPath).
+			Call(geoclue2.GeoclueAgentAuthorizeApp, 0, desktopId, uint32(geoclue2.GClueAccuracyLevelExact)).
+			Store(&authorized, &level)
+		return authorized, geoclue2.GClueAccuracyLevel(level), err
+	}
+	// the first connection is the one of the service
+	authorized, level, err := authorizeApp(f.conns[0], "maps")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !authorized || level != geoclue2.GClueAccuracyLevelStreet {
+		t.Errorf("AuthorizeApp() = %v, %v, want true, %v", authorized, level, geoclue2.GClueAccuracyLevelStreet)
+	}
+	authorized, level, err = authorizeApp(f.conns[0], "weather")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !authorized || level != geoclue2.GClueAccuracyLevelCity {
+		t.Errorf("AuthorizeApp() = %v, %v, want true, %v", authorized, level, geoclue2.GClueAccuracyLevelCity)
+	}
+	authorized, _, err = authorizeApp(f.conns[0], "untrusted")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if authorized {
+		t.Error("AuthorizeApp() of a denied application = true")
+	}
+
+	// other peers than the GeoClue2 service must not ask the agent
+	var dbusErr dbus.Error
+	_, _, err = authorizeApp(f.dial(t), "maps")
+	if !errors.As(err, &dbusErr) || dbusErr.Name != geoclue2.DBusErrorAccessDenied {
+		t.Errorf("AuthorizeApp() from another peer = %v, want %s", err, geoclue2.DBusErrorAccessDenied)
+	}
+}
@@ -1,10 +1,12 @@
 package geoclue2
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/godbus/dbus/v5"
+	"sync"
 	"time"
 )
 
@@ -32,15 +34,21 @@ const (
 // GeoclueClient interface you use to retrieve location information and receive location update signals from GeoClue service.
 // You get the client object to use this interface on from org.freedesktop.GeoClue2.Manager.GetClient() method.
 type GeoclueClient interface {
+	// The object path of the client, e.g. /org/freedesktop/GeoClue2/Client/1.
+	ObjectPath() dbus.ObjectPath
 
 	/* METHODS */
+	// Every method has a ...WithContext variant, which passes the context to the underlying D-Bus call
+	// so cancellation and deadlines are honored.
 
 	// Start receiving events about the current location. Applications should hook-up to
 	// LocationUpdated" signal before calling this method.
 	Start() error
+	StartWithContext(ctx context.Context) error
 
 	// Stop receiving events about the current location.
 	Stop() error
+	StopWithContext(ctx context.Context) error
 
 	/* PROPERTIES */
 
@@ -49,35 +57,48 @@ type GeoclueClient interface {
 	// You want to delay reading this property until your callback to "LocationUpdated" signal is
 	// called for the first time after starting the client.
 	GetLocation() (GeoclueLocation, error)
+	GetLocationWithContext(ctx context.Context) (GeoclueLocation, error)
 
 	// Contains the current distance threshold in meters. This value is used by the service when it gets new location info.
 	// If the distance moved is below the threshold, it won't emit the LocationUpdated signal. The default value is 0.
 	// When TimeThreshold is zero, it always emits the signal.
 	GetDistanceThreshold() (uint32, error)
 	SetDistanceThreshold(uint32) error
+	GetDistanceThresholdWithContext(ctx context.Context) (uint32, error)
+	SetDistanceThresholdWithContext(ctx context.Context, value uint32) error
 
 	// Contains the current time threshold in seconds. This value is used by the service when it gets new location info.
 	// If the time since the last update is below the threshold, it won't emit the LocationUpdated signal.
 	// The default value is 0. When TimeThreshold is zero, it always emits the signal.
 	GetTimeThreshold() (uint32, error)
 	SetTimeThreshold(uint32) error
+	GetTimeThresholdWithContext(ctx context.Context) (uint32, error)
+	SetTimeThresholdWithContext(ctx context.Context, value uint32) error
 
 	// The desktop file id (the basename of the desktop file).
 	// This property must be set by applications for authorization to work.
 	// e.g. firefox
 	GetDesktopId() (string, error)
 	SetDesktopId(string) error
+	GetDesktopIdWithContext(ctx context.Context) (string, error)
+	SetDesktopIdWithContext(ctx context.Context, value string) error
 
 	// The level of accuracy requested by client, as GClueAccuracyLevel.
 	// Please keep in mind that the actual accuracy of location information is dependent on available hardware on
 	// your machine, external resources and/or how much accuracy user agrees to be comfortable with.
 	GetRequestedAccuracyLevel() (GClueAccuracyLevel, error)
 	SetRequestedAccuracyLevel(level GClueAccuracyLevel) error
+	GetRequestedAccuracyLevelWithContext(ctx context.Context) (GClueAccuracyLevel, error)
+	SetRequestedAccuracyLevelWithContext(ctx context.Context, level GClueAccuracyLevel) error
 
 	// If client is active, i-e started successfully using Start() and receiving location updates.
 	// Please keep in mind that geoclue can at any time stop and start the client on user (agent) request.
 	// Applications that are interested in in these changes, should watch for changes in this property.
 	IsActive() (bool, error)
+	IsActiveWithContext(ctx context.Context) (bool, error)
+	// WatchActive subscribes to the PropertiesChanged signal of this client object and sends an event whenever
+	// the Active property changes, e.g. when the agent revoked the authorization. The channel is closed when ctx is done.
+	WatchActive(ctx context.Context) (<-chan ActiveEvent, error)
 
 	MarshalJSON() ([]byte, error)
 
@@ -87,60 +108,105 @@ type GeoclueClient interface {
 	// DistanceThreshold property to control how often this signal is emitted.
 	// o old: old location as path to a #org.freedesktop.Geoclue2.Location object
 	// o new: new location as path to a #org.freedesktop.Geoclue2.Location object
+	// Only the signals emitted by the GeoClue2 service for this client object are delivered. Repeated calls return
+	// the same channel, which is closed by Unsubscribe(). It is safe to call from multiple goroutines.
 	SubscribeLocationUpdated() <-chan *dbus.Signal
 	// Parse the signal and return the old and new Location
 	ParseLocationUpdated(v *dbus.Signal) (oldLocation GeoclueLocation, newLocation GeoclueLocation, err error)
 
 	Unsubscribe()
+
+	// Watch subscribes to the LocationUpdated signal and sends an event with the fully read old and new location
+	// for every signal. Subscribe before calling Start(). The channel is closed when ctx is done.
+	Watch(ctx context.Context) (<-chan LocationEvent, error)
+}
+
+// LocationEvent is sent by Watch() for every LocationUpdated signal.
+type LocationEvent struct {
+	// The previous location, nil if there was none.
+	Old *Location
+	// The new location.
+	New Location
+	// Set if the signal or one of the locations could not be read, Old and New are not valid then.
+	Err error
+}
+
+// ActiveEvent is sent by WatchActive() for every change of the Active property.
+type ActiveEvent struct {
+	// The new value of Active.
+	Active bool
+	// Set if the signal or the invalidated property could not be read, Active is not valid then.
+	Err error
 }
 
 // NewGeoclueClient returns new GeoclueClient Interface
-func NewGeoclueClient(objectPath dbus.ObjectPath) (GeoclueClient, error) {
+func NewGeoclueClient(objectPath dbus.ObjectPath, opts ...Option) (GeoclueClient, error) {
 	var gcc geoclueClient
-	return &gcc, gcc.init(GeoclueInterface, objectPath)
+	return &gcc, gcc.init(GeoclueInterface, objectPath, opts...)
 }
 
 type geoclueClient struct {
 	dbusBase
-	sigChan chan *dbus.Signal
+	mu  sync.Mutex
+	sub *signalSubscription
+}
+
+func (gcc *geoclueClient) Start() error {
+	return gcc.StartWithContext(context.Background())
 }
 
-func (gcc geoclueClient) Start() error {
-	err := gcc.call(GeoclueClientStart)
+func (gcc *geoclueClient) StartWithContext(ctx context.Context) error {
+	err := gcc.call(ctx, GeoclueClientStart)
 	if err != nil {
 		return err
 	}
 	return err
 }
 
-func (gcc geoclueClient) Stop() error {
-	err := gcc.call(GeoclueClientStop)
+func (gcc *geoclueClient) Stop() error {
+	return gcc.StopWithContext(context.Background())
+}
+
+func (gcc *geoclueClient) StopWithContext(ctx context.Context) error {
+	err := gcc.call(ctx, GeoclueClientStop)
 	if err != nil {
 		return err
 	}
 	return err
 }
 
-func (gcc geoclueClient) GetLocation() (GeoclueLocation, error) {
+func (gcc *geoclueClient) GetLocation() (GeoclueLocation, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return gcc.GetLocationWithContext(ctx)
+}
+
+func (gcc *geoclueClient) GetLocationWithContext(ctx context.Context) (GeoclueLocation, error) {
 	var objPath dbus.ObjectPath
-	cActive, err := gcc.IsActive()
+	cActive, err := gcc.IsActiveWithContext(ctx)
 	if err != nil {
 		return nil, err
 	}
 	if !cActive {
-		return nil, errors.New("client must be started before gathering the location")
+		return nil, ErrNotActive
 	}
 
-	timeout := time.After(5 * time.Second)
 	// Please note that this property will be set to "/" (D-Bus equivalent of null) initially,
 	// until Geoclue finds user's location. You want to delay reading this property until
 	// your callback to "LocationUpdated" signal is called for the first time after starting the client.
-	c := gcc.SubscribeLocationUpdated()
+	sub, err := gcc.subscribeSignal(GeoclueClientInterface, GeoclueClientSignalLocationUpdated)
+	if err != nil {
+		return nil, err
+	}
+	defer sub.Close()
 	select {
-	case <-timeout:
-		return nil, errors.New("timed out gathering location object")
-	case <-c:
-		objPath, err = gcc.getObjectProperty(GeoclueClientPropertyLocation)
+	case <-ctx.Done():
+		if ctx.Err() == context.DeadlineExceeded {
+			return nil, ErrTimeout
+		}
+		return nil, ctx.Err()
+	case <-sub.C:
+		objPath, err = gcc.getObjectProperty(ctx, GeoclueClientPropertyLocation)
 		if err != nil {
 			return nil, err
 		}
@@ -148,64 +214,120 @@ func (gcc geoclueClient) GetLocation() (GeoclueLocation, error) {
 			break
 		}
 	}
-	gcc.Unsubscribe()
 
-	return NewGeoclueLocation(objPath)
+	return NewGeoclueLocation(objPath, WithConn(gcc.conn))
 }
 
-func (gcc geoclueClient) GetDistanceThreshold() (uint32, error) {
-	v, err := gcc.getUint32Property(GeoclueClientPropertyDistanceThreshold)
+func (gcc *geoclueClient) GetDistanceThreshold() (uint32, error) {
+	return gcc.GetDistanceThresholdWithContext(context.Background())
+}
+
+func (gcc *geoclueClient) GetDistanceThresholdWithContext(ctx context.Context) (uint32, error) {
+	v, err := gcc.getUint32Property(ctx, GeoclueClientPropertyDistanceThreshold)
 	return v, err
 }
 
-func (gcc geoclueClient) SetDistanceThreshold(value uint32) error {
-	return gcc.setProperty(GeoclueClientPropertyDistanceThreshold, value)
+func (gcc *geoclueClient) SetDistanceThreshold(value uint32) error {
+	return gcc.SetDistanceThresholdWithContext(context.Background(), value)
+}
+
+func (gcc *geoclueClient) SetDistanceThresholdWithContext(ctx context.Context, value uint32) error {
+	return gcc.setProperty(ctx, GeoclueClientPropertyDistanceThreshold, value)
+}
 
+func (gcc *geoclueClient) GetTimeThreshold() (uint32, error) {
+	return gcc.GetTimeThresholdWithContext(context.Background())
 }
 
-func (gcc geoclueClient) GetTimeThreshold() (uint32, error) {
-	v, err := gcc.getUint32Property(GeoclueClientPropertyTimeThreshold)
+func (gcc *geoclueClient) GetTimeThresholdWithContext(ctx context.Context) (uint32, error) {
+	v, err := gcc.getUint32Property(ctx, GeoclueClientPropertyTimeThreshold)
 	return v, err
 }
 
-func (gcc geoclueClient) SetTimeThreshold(value uint32) error {
-	return gcc.setProperty(GeoclueClientPropertyTimeThreshold, value)
+func (gcc *geoclueClient) SetTimeThreshold(value uint32) error {
+	return gcc.SetTimeThresholdWithContext(context.Background(), value)
+}
+
+func (gcc *geoclueClient) SetTimeThresholdWithContext(ctx context.Context, value uint32) error {
+	return gcc.setProperty(ctx, GeoclueClientPropertyTimeThreshold, value)
+}
+
+func (gcc *geoclueClient) GetDesktopId() (string, error) {
+	return gcc.GetDesktopIdWithContext(context.Background())
 }
 
-func (gcc geoclueClient) GetDesktopId() (string, error) {
-	v, err := gcc.getStringProperty(GeoclueClientPropertyDesktopId)
+func (gcc *geoclueClient) GetDesktopIdWithContext(ctx context.Context) (string, error) {
+	v, err := gcc.getStringProperty(ctx, GeoclueClientPropertyDesktopId)
 	return v, err
 }
 
-func (gcc geoclueClient) SetDesktopId(value string) error {
-	return gcc.setProperty(GeoclueClientPropertyDesktopId, value)
+func (gcc *geoclueClient) SetDesktopId(value string) error {
+	return gcc.SetDesktopIdWithContext(context.Background(), value)
 }
 
-func (gcc geoclueClient) GetRequestedAccuracyLevel() (GClueAccuracyLevel, error) {
-	v, err := gcc.getUint32Property(GeoclueClientPropertyRequestedAccuracyLevel)
+func (gcc *geoclueClient) SetDesktopIdWithContext(ctx context.Context, value string) error {
+	return gcc.setProperty(ctx, GeoclueClientPropertyDesktopId, value)
+}
+
+func (gcc *geoclueClient) GetRequestedAccuracyLevel() (GClueAccuracyLevel, error) {
+	return gcc.GetRequestedAccuracyLevelWithContext(context.Background())
+}
+
+func (gcc *geoclueClient) GetRequestedAccuracyLevelWithContext(ctx context.Context) (GClueAccuracyLevel, error) {
+	v, err := gcc.getUint32Property(ctx, GeoclueClientPropertyRequestedAccuracyLevel)
 	return GClueAccuracyLevel(v), err
 }
 
-func (gcc geoclueClient) SetRequestedAccuracyLevel(level GClueAccuracyLevel) error {
-	return gcc.setProperty(GeoclueClientPropertyRequestedAccuracyLevel, level)
+func (gcc *geoclueClient) SetRequestedAccuracyLevel(level GClueAccuracyLevel) error {
+	return gcc.SetRequestedAccuracyLevelWithContext(context.Background(), level)
+}
+
+func (gcc *geoclueClient) SetRequestedAccuracyLevelWithContext(ctx context.Context, level GClueAccuracyLevel) error {
+	return gcc.setProperty(ctx, GeoclueClientPropertyRequestedAccuracyLevel, level)
 }
 
-func (gcc geoclueClient) IsActive() (bool, error) {
-	v, err := gcc.getBoolProperty(GeoclueClientPropertyActive)
+func (gcc *geoclueClient) IsActive() (bool, error) {
+	return gcc.IsActiveWithContext(context.Background())
+}
+
+func (gcc *geoclueClient) IsActiveWithContext(ctx context.Context) (bool, error) {
+	v, err := gcc.getBoolProperty(ctx, GeoclueClientPropertyActive)
 	return v, err
 }
 
-func (gcc geoclueClient) SubscribeLocationUpdated() <-chan *dbus.Signal {
-	if gcc.sigChan != nil {
-		return gcc.sigChan
+func (gcc *geoclueClient) SubscribeLocationUpdated() <-chan *dbus.Signal {
+	gcc.mu.Lock()
+	defer gcc.mu.Unlock()
+	if gcc.sub != nil {
+		return gcc.sub.C
+	}
+	sub, err := gcc.subscribeSignal(GeoclueClientInterface, GeoclueClientSignalLocationUpdated)
+	if err != nil {
+		closed := make(chan *dbus.Signal)
+		close(closed)
+		return closed
 	}
-	rule := fmt.Sprintf("type='signal', member='%s',path_namespace='%s'", GeoclueClientSignalLocationUpdated, GeoclueClientObjectPath)
-	gcc.conn.BusObject().Call(dbusMethodAddMatch, 0, rule)
-	gcc.sigChan = make(chan *dbus.Signal, 10)
-	gcc.conn.Signal(gcc.sigChan)
-	return gcc.sigChan
+	gcc.sub = sub
+	return gcc.sub.C
 }
-func (gcc geoclueClient) ParseLocationUpdated(v *dbus.Signal) (oldLocation GeoclueLocation, newLocation GeoclueLocation, err error) {
+
+func (gcc *geoclueClient) ParseLocationUpdated(v *dbus.Signal) (oldLocation GeoclueLocation, newLocation GeoclueLocation, err error) {
+	oPath, nPath, err := parseLocationUpdated(v)
+	if err != nil {
+		return
+	}
+	oldLocation, err = NewGeoclueLocation(oPath, WithConn(gcc.conn))
+	if err != nil {
+		return
+	}
+	newLocation, err = NewGeoclueLocation(nPath, WithConn(gcc.conn))
+	if err != nil {
+		return
+	}
+	return
+}
+
+func parseLocationUpdated(v *dbus.Signal) (oPath dbus.ObjectPath, nPath dbus.ObjectPath, err error) {
 	if len(v.Body) != 2 {
 		err = errors.New("error by parsing activation changed signal")
 		return
@@ -215,28 +337,170 @@ func (gcc geoclueClient) ParseLocationUpdated(v *dbus.Signal) (oldLocation Geocl
 		err = errors.New("error by parsing old object path")
 		return
 	}
-	oldLocation, err = NewGeoclueLocation(oPath)
-	if err != nil {
-		return
-	}
-	nPath, ok := v.Body[1].(dbus.ObjectPath)
+	nPath, ok = v.Body[1].(dbus.ObjectPath)
 	if !ok {
 		err = errors.New("error by parsing new object path")
 		return
 	}
-	newLocation, err = NewGeoclueLocation(nPath)
+	return
+}
+
+func (gcc *geoclueClient) Unsubscribe() {
+	gcc.mu.Lock()
+	defer gcc.mu.Unlock()
+	if gcc.sub != nil {
+		gcc.sub.Close()
+		gcc.sub = nil
+	}
+}
+
+func (gcc *geoclueClient) Watch(ctx context.Context) (<-chan LocationEvent, error) {
+	sub, err := gcc.subscribeSignal(GeoclueClientInterface, GeoclueClientSignalLocationUpdated)
+	if err != nil {
+		return nil, err
+	}
+	return gcc.watchLocations(ctx, sub, "/"), nil
+}
+
+// watchFromCurrent is Watch(), but sends the current location first, if there is one. The LocationUpdated signal
+// of the current location is skipped, in case it is received after subscribing.
+func (gcc *geoclueClient) watchFromCurrent(ctx context.Context) (<-chan LocationEvent, error) {
+	sub, err := gcc.subscribeSignal(GeoclueClientInterface, GeoclueClientSignalLocationUpdated)
+	if err != nil {
+		return nil, err
+	}
+	current, err := gcc.getObjectProperty(ctx, GeoclueClientPropertyLocation)
 	if err != nil {
+		sub.Close()
+		return nil, err
+	}
+	return gcc.watchLocations(ctx, sub, current), nil
+}
+
+// watchLocations sends an event for the current location unless it is "/", and for every signal of sub.
+func (gcc *geoclueClient) watchLocations(ctx context.Context, sub *signalSubscription, current dbus.ObjectPath) <-chan LocationEvent {
+	events := make(chan LocationEvent)
+	go func() {
+		defer close(events)
+		defer sub.Close()
+		if current != "/" {
+			var event LocationEvent
+			event.New, event.Err = gcc.readLocationPath(ctx, current)
+			select {
+			case events <- event:
+			case <-ctx.Done():
+				return
+			}
+		}
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case v, ok := <-sub.C:
+				if !ok {
+					return
+				}
+				if _, nPath, err := parseLocationUpdated(v); err == nil && current != "/" && nPath == current {
+					continue
+				}
+				event := gcc.readLocationEvent(ctx, v)
+				select {
+				case events <- event:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return events
+}
+
+func (gcc *geoclueClient) readLocationEvent(ctx context.Context, v *dbus.Signal) (event LocationEvent) {
+	oPath, nPath, err := parseLocationUpdated(v)
+	if err != nil {
+		event.Err = err
 		return
 	}
+	if oPath != "/" {
+		old, err := gcc.readLocationPath(ctx, oPath)
+		if err != nil {
+			event.Err = err
+			return
+		}
+		event.Old = &old
+	}
+	event.New, event.Err = gcc.readLocationPath(ctx, nPath)
 	return
 }
 
-func (gcc geoclueClient) Unsubscribe() {
-	gcc.conn.RemoveSignal(gcc.sigChan)
-	gcc.sigChan = nil
+func (gcc *geoclueClient) WatchActive(ctx context.Context) (<-chan ActiveEvent, error) {
+	sub, err := gcc.subscribeSignal(dbusPropertiesInterface, dbusSignalPropertiesChanged)
+	if err != nil {
+		return nil, err
+	}
+
+	events := make(chan ActiveEvent)
+	go func() {
+		defer close(events)
+		defer sub.Close()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case v, ok := <-sub.C:
+				if !ok {
+					return
+				}
+				event, ok := gcc.readActiveEvent(ctx, v)
+				if !ok {
+					continue
+				}
+				select {
+				case events <- event:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return events, nil
+}
+
+// readActiveEvent parses a PropertiesChanged signal, an invalidated Active property is read again.
+// It returns false if the signal does not change Active.
+func (gcc *geoclueClient) readActiveEvent(ctx context.Context, v *dbus.Signal) (event ActiveEvent, ok bool) {
+	iface, changed, invalidated, err := gcc.parsePropertiesChanged(v)
+	if err != nil {
+		return ActiveEvent{Err: err}, true
+	}
+	if iface != GeoclueClientInterface {
+		return event, false
+	}
+	if value, found := changed["Active"]; found {
+		active, isBool := value.Value().(bool)
+		if !isBool {
+			return ActiveEvent{Err: errors.New("error by parsing Active")}, true
+		}
+		return ActiveEvent{Active: active}, true
+	}
+	for _, name := range invalidated {
+		if name == "Active" {
+			active, err := gcc.IsActiveWithContext(ctx)
+			return ActiveEvent{Active: active, Err: err}, true
+		}
+	}
+	return event, false
+}
+
+func (gcc *geoclueClient) readLocationPath(ctx context.Context, path dbus.ObjectPath) (Location, error) {
+	gcl, err := NewGeoclueLocation(path, WithConn(gcc.conn))
+	if err != nil {
+		return Location{}, err
+	}
+	return gcl.Snapshot(ctx)
 }
 
-func (gcc geoclueClient) MarshalJSON() ([]byte, error) {
+func (gcc *geoclueClient) MarshalJSON() ([]byte, error) {
 	location, err := gcc.GetLocation()
 	if err != nil {
 		return nil, err
@@ -268,8 +532,8 @@ func (gcc geoclueClient) MarshalJSON() ([]byte, error) {
 	}
 
 	return json.Marshal(map[string]interface{}{
-		"Location":               mLocation,
-		"DistanceThreshold  ":    distanceThreshold,
+		"Location":               json.RawMessage(mLocation),
+		"DistanceThreshold":      distanceThreshold,
 		"TimeThreshold":          timeThreshold,
 		"DesktopId":              desktopId,
 		"RequestedAccuracyLevel": requestedAccuracyLevel,
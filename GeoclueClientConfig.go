@@ -0,0 +1,140 @@
+package geoclue2
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RollbackTimeout limits the Stop() and DeleteClient() calls made when Open() fails or a client returned by Open()
+// or a supervised client is closed.
+const RollbackTimeout = 5 * time.Second
+
+// ClientConfig describes a client, which is created and configured with GeoclueManager.Open().
+type ClientConfig struct {
+	// The desktop id of the application (excluding .desktop), required by geoclue to authorize the client.
+	DesktopId string
+	// The requested accuracy level, must not be GClueAccuracyLevelNone.
+	RequestedAccuracyLevel GClueAccuracyLevel
+	// The distance threshold in meters, 0 for none.
+	DistanceThreshold uint32
+	// The time threshold in seconds, 0 for none.
+	TimeThreshold uint32
+	// Use GetClient() instead of CreateClient(), so the client of the connection is shared with its other users.
+	// A shared client is only stopped on Close() or a failed Open(), it is not deleted.
+	Shared bool
+}
+
+// Validate checks the configuration, the returned errors wrap ErrInvalidArgs.
+func (cfg ClientConfig) Validate() error {
+	if cfg.DesktopId == "" {
+		return fmt.Errorf("%w: DesktopId must be set", ErrInvalidArgs)
+	}
+	if strings.HasSuffix(cfg.DesktopId, ".desktop") {
+		return fmt.Errorf("%w: DesktopId '%s' must not include the .desktop suffix", ErrInvalidArgs, cfg.DesktopId)
+	}
+	if cfg.RequestedAccuracyLevel == GClueAccuracyLevelNone {
+		return fmt.Errorf("%w: RequestedAccuracyLevel must be set", ErrInvalidArgs)
+	}
+	for _, level := range gclueAccuracyLevels {
+		if cfg.RequestedAccuracyLevel == level {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: invalid RequestedAccuracyLevel %d", ErrInvalidArgs, cfg.RequestedAccuracyLevel)
+}
+
+// GeoclueClientCloser is a started client returned by GeoclueManager.Open(). Close stops the client and deletes it,
+// unless it is shared.
+type GeoclueClientCloser interface {
+	GeoclueClient
+	io.Closer
+}
+
+type geoclueClientCloser struct {
+	GeoclueClient
+	client  *geoclueClient
+	manager GeoclueManager
+	shared  bool
+
+	mu     sync.Mutex
+	closed bool
+}
+
+// Watch sends the current location of the client first, if there is one, as the client is started already.
+func (gcc *geoclueClientCloser) Watch(ctx context.Context) (<-chan LocationEvent, error) {
+	return gcc.client.watchFromCurrent(ctx)
+}
+
+func (gcc *geoclueClientCloser) Close() error {
+	gcc.mu.Lock()
+	defer gcc.mu.Unlock()
+	if gcc.closed {
+		return ErrClosed
+	}
+	gcc.closed = true
+	return closeClient(gcc.manager, gcc.GeoclueClient, gcc.shared)
+}
+
+// closeClient stops the client and deletes it unless it is shared. It uses a fresh context, as the context of the
+// caller may be done already.
+func closeClient(gcm GeoclueManager, gcc GeoclueClient, shared bool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), RollbackTimeout)
+	defer cancel()
+	err := gcc.StopWithContext(ctx)
+	if shared {
+		return err
+	}
+	if err := gcm.DeleteClientWithContext(ctx, gcc); err != nil {
+		return err
+	}
+	return err
+}
+
+func (gcm *geoclueManager) Open(ctx context.Context, cfg ClientConfig) (GeoclueClientCloser, error) {
+	err := cfg.Validate()
+	if err != nil {
+		return nil, err
+	}
+	var gcc GeoclueClient
+	if cfg.Shared {
+		gcc, err = gcm.GetClientWithContext(ctx)
+	} else {
+		gcc, err = gcm.CreateClientWithContext(ctx)
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = cfg.apply(ctx, gcc)
+	if err == nil {
+		err = gcc.StartWithContext(ctx)
+	}
+	if err != nil {
+		// the error of the rollback is dropped in favor of the original error
+		_ = closeClient(gcm, gcc, cfg.Shared)
+		return nil, err
+	}
+	return &geoclueClientCloser{GeoclueClient: gcc, client: gcc.(*geoclueClient), manager: gcm, shared: cfg.Shared}, nil
+}
+
+// apply sets the desktop id, the requested accuracy level and the thresholds on the client, in this order.
+// An empty desktop id and GClueAccuracyLevelNone are not set, the configuration is not validated.
+func (cfg ClientConfig) apply(ctx context.Context, gcc GeoclueClient) error {
+	if cfg.DesktopId != "" {
+		if err := gcc.SetDesktopIdWithContext(ctx, cfg.DesktopId); err != nil {
+			return err
+		}
+	}
+	if cfg.RequestedAccuracyLevel != GClueAccuracyLevelNone {
+		if err := gcc.SetRequestedAccuracyLevelWithContext(ctx, cfg.RequestedAccuracyLevel); err != nil {
+			return err
+		}
+	}
+	if err := gcc.SetDistanceThresholdWithContext(ctx, cfg.DistanceThreshold); err != nil {
+		return err
+	}
+	return gcc.SetTimeThresholdWithContext(ctx, cfg.TimeThreshold)
+}
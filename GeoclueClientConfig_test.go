@@ -0,0 +1,113 @@
+package geoclue2_test
+
+import (
+	"errors"
+	"github.com/maltegrosse/go-geoclue2"
+	"github.com/maltegrosse/go-geoclue2/geoclue2test"
+	"testing"
+	"time"
+)
+
+func TestOpen(t *testing.T) {
+	f := newFake(t)
+	defer f.close()
+	gcm := f.manager(t)
+	ctx, cancel := contextWithTimeout()
+	defer cancel()
+
+	for _, cfg := range []geoclue2.ClientConfig{
+		{RequestedAccuracyLevel: geoclue2.GClueAccuracyLevelCity},
+		{DesktopId: "test.desktop", RequestedAccuracyLevel: geoclue2.GClueAccuracyLevelCity},
+		{DesktopId: "test"},
+		{DesktopId: "test", RequestedAccuracyLevel: 3},
+	} {
+		if _, err := gcm.Open(ctx, cfg); !errors.Is(err, geoclue2.ErrInvalidArgs) {
+			t.Errorf("Open(%+v) = %v, want ErrInvalidArgs", cfg, err)
+		}
+	}
+	if clients := f.srv.Clients(); len(clients) != 0 {
+		t.Errorf("%d clients after invalid configurations, want 0", len(clients))
+	}
+
+	// the location is delivered on start, before the caller can subscribe
+	f.srv.SetLocation(geoclue2test.NewLocation(1, 2, 10))
+	client, err := gcm.Open(ctx, geoclue2.ClientConfig{
+		DesktopId:              "test",
+		RequestedAccuracyLevel: geoclue2.GClueAccuracyLevelCity,
+		DistanceThreshold:      100,
+		TimeThreshold:          10,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	state, ok := f.srv.Client(client.ObjectPath())
+	if !ok {
+		t.Fatalf("client %s not found", client.ObjectPath())
+	}
+	if !state.Active || state.DesktopId != "test" || state.RequestedAccuracyLevel != geoclue2.GClueAccuracyLevelCity ||
+		state.DistanceThreshold != 100 || state.TimeThreshold != 10 {
+		t.Errorf("client after Open() %+v, want the configured, started client", state)
+	}
+
+	// Watch sends the current location first and does not repeat it
+	events, err := client.Watch(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if event := nextLocation(t, events); event.Latitude != 1 {
+		t.Errorf("first location %+v, want latitude 1", event)
+	}
+	// beyond the time threshold of the client
+	next := geoclue2test.NewLocation(3, 4, 10)
+	next.Timestamp = next.Timestamp.Add(time.Minute)
+	f.srv.SetLocation(next)
+	if event := nextLocation(t, events); event.Latitude != 3 {
+		t.Errorf("second location %+v, want latitude 3", event)
+	}
+
+	if err := client.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if clients := f.srv.Clients(); len(clients) != 0 {
+		t.Errorf("%d clients after Close(), want 0", len(clients))
+	}
+	if err := client.Close(); !errors.Is(err, geoclue2.ErrClosed) {
+		t.Errorf("second Close() = %v, want ErrClosed", err)
+	}
+}
+
+func TestOpenShared(t *testing.T) {
+	f := newFake(t)
+	defer f.close()
+	gcm := f.manager(t)
+	ctx, cancel := contextWithTimeout()
+	defer cancel()
+
+	shared, err := gcm.GetClientWithContext(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := gcm.Open(ctx, geoclue2.ClientConfig{
+		DesktopId:              "test",
+		RequestedAccuracyLevel: geoclue2.GClueAccuracyLevelCity,
+		Shared:                 true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if client.ObjectPath() != shared.ObjectPath() {
+		t.Errorf("Open() returned %s, want the shared client %s", client.ObjectPath(), shared.ObjectPath())
+	}
+
+	// Close stops the shared client, but does not delete it for its other users
+	if err := client.Close(); err != nil {
+		t.Fatal(err)
+	}
+	state, ok := f.srv.Client(shared.ObjectPath())
+	if !ok {
+		t.Fatalf("shared client %s deleted by Close()", shared.ObjectPath())
+	}
+	if state.Active {
+		t.Error("shared client active after Close()")
+	}
+}
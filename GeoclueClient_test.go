@@ -0,0 +1,173 @@
+package geoclue2_test
+
+import (
+	"errors"
+	"github.com/maltegrosse/go-geoclue2"
+	"github.com/maltegrosse/go-geoclue2/geoclue2test"
+	"testing"
+	"time"
+)
+
+func TestGetLocation(t *testing.T) {
+	f := newFake(t)
+	defer f.close()
+	gcc := newClient(t, f.manager(t), "test")
+
+	if _, err := gcc.GetLocation(); !errors.Is(err, geoclue2.ErrNotActive) {
+		t.Fatalf("GetLocation() of a stopped client = %v, want ErrNotActive", err)
+	}
+	if err := gcc.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	// GetLocation waits for the next LocationUpdated signal, so keep the location coming until it returns
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			f.srv.SetLocation(geoclue2test.NewLocation(52.52, 13.40, 10))
+			select {
+			case <-done:
+				return
+			case <-time.After(50 * time.Millisecond):
+			}
+		}
+	}()
+	loc, err := gcc.GetLocation()
+	if err != nil {
+		t.Fatal(err)
+	}
+	lat, err := loc.GetLatitude()
+	if err != nil {
+		t.Fatal(err)
+	}
+	lon, err := loc.GetLongitude()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lat != 52.52 || lon != 13.40 {
+		t.Errorf("GetLocation() = %v,%v, want 52.52,13.4", lat, lon)
+	}
+}
+
+func TestSubscribeLocationUpdated(t *testing.T) {
+	f := newFake(t)
+	defer f.close()
+	gcc := newClient(t, f.manager(t), "test")
+
+	c := gcc.SubscribeLocationUpdated()
+	if c2 := gcc.SubscribeLocationUpdated(); c2 != c {
+		t.Error("SubscribeLocationUpdated() returned a new channel on the second call")
+	}
+	f.srv.SetLocation(geoclue2test.NewLocation(1, 2, 10))
+	if err := gcc.Start(); err != nil {
+		t.Fatal(err)
+	}
+	receive := func() (oldLat, newLat float64) {
+		t.Helper()
+		select {
+		case v := <-c:
+			oldLocation, newLocation, err := gcc.ParseLocationUpdated(v)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if oldLocation.ObjectPath() != "/" {
+				if oldLat, err = oldLocation.GetLatitude(); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if newLat, err = newLocation.GetLatitude(); err != nil {
+				t.Fatal(err)
+			}
+			return oldLat, newLat
+		case <-time.After(timeout):
+			t.Fatal("no LocationUpdated signal")
+		}
+		return
+	}
+
+	// the service delivers its current location on Start
+	if oldLat, newLat := receive(); oldLat != 0 || newLat != 1 {
+		t.Errorf("first signal: old %v, new %v, want 0 (none) and 1", oldLat, newLat)
+	}
+	f.srv.SetLocation(geoclue2test.NewLocation(3, 4, 10))
+	if oldLat, newLat := receive(); oldLat != 1 || newLat != 3 {
+		t.Errorf("second signal: old %v, new %v, want 1 and 3", oldLat, newLat)
+	}
+
+	gcc.Unsubscribe()
+	select {
+	case _, ok := <-c:
+		if ok {
+			t.Error("signal received after Unsubscribe()")
+		}
+	case <-time.After(timeout):
+		t.Error("channel not closed by Unsubscribe()")
+	}
+}
+
+func TestParseLocationUpdatedInvalid(t *testing.T) {
+	f := newFake(t)
+	defer f.close()
+	gcc := newClient(t, f.manager(t), "test")
+
+	if err := gcc.Start(); err != nil {
+		t.Fatal(err)
+	}
+	c := gcc.SubscribeLocationUpdated()
+	defer gcc.Unsubscribe()
+	f.srv.SetLocation(geoclue2test.NewLocation(1, 2, 10))
+	select {
+	case v := <-c:
+		v.Body = v.Body[:1]
+		if _, _, err := gcc.ParseLocationUpdated(v); err == nil {
+			t.Error("ParseLocationUpdated() of a signal with one argument returned no error")
+		}
+	case <-time.After(timeout):
+		t.Fatal("no LocationUpdated signal")
+	}
+}
+
+func TestDeny(t *testing.T) {
+	f := newFake(t)
+	defer f.close()
+	gcm := f.manager(t)
+
+	f.srv.Deny("denied")
+	denied := newClient(t, gcm, "denied")
+	if err := denied.Start(); !errors.Is(err, geoclue2.ErrAccessDenied) {
+		t.Errorf("Start() of a denied application = %v, want ErrAccessDenied", err)
+	}
+
+	// denying an application stops its running clients
+	gcc := newClient(t, gcm, "test")
+	if err := gcc.Start(); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := contextWithTimeout()
+	defer cancel()
+	events, err := gcc.WatchActive(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.srv.Deny("test")
+	select {
+	case event := <-events:
+		if event.Err != nil || event.Active {
+			t.Errorf("ActiveEvent after Deny() = %+v, want inactive", event)
+		}
+	case <-ctx.Done():
+		t.Fatal("no ActiveEvent after Deny()")
+	}
+	if active, err := gcc.IsActive(); err != nil || active {
+		t.Errorf("IsActive() after Deny() = %v, %v, want false", active, err)
+	}
+	if err := gcc.Start(); !errors.Is(err, geoclue2.ErrAccessDenied) {
+		t.Errorf("Start() after Deny() = %v, want ErrAccessDenied", err)
+	}
+
+	f.srv.Allow("test")
+	if err := gcc.Start(); err != nil {
+		t.Errorf("Start() after Allow() = %v", err)
+	}
+}
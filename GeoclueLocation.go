@@ -1,8 +1,11 @@
 package geoclue2
 
 import (
+	"context"
 	"encoding/json"
 	"github.com/godbus/dbus/v5"
+	"math"
+	"strings"
 	"time"
 )
 
@@ -34,119 +37,277 @@ const (
 
 // GeoclueLocation interface you use on location objects.
 type GeoclueLocation interface {
+	// The object path of the location, e.g. /org/freedesktop/GeoClue2/Client/1/Location/0.
+	ObjectPath() dbus.ObjectPath
+
 	/* METHODS */
+	// Every method has a ...WithContext variant, which passes the context to the underlying D-Bus call
+	// so cancellation and deadlines are honored.
+
 	// The latitude of the location, in degrees.
 	GetLatitude() (float64, error)
+	GetLatitudeWithContext(ctx context.Context) (float64, error)
 	// The longitude of the location, in degrees.
 	GetLongitude() (float64, error)
+	GetLongitudeWithContext(ctx context.Context) (float64, error)
 	// The accuracy of the location fix, in meters.
 	GetAccuracy() (float64, error)
+	GetAccuracyWithContext(ctx context.Context) (float64, error)
 	// The altitude of the location fix, in meters. When unknown, its set to minimum double value, -1.7976931348623157e+308.
 	GetAltitude() (float64, error)
+	GetAltitudeWithContext(ctx context.Context) (float64, error)
 	// The speed in meters per second. When unknown, it's set to -1.0.
 	GetSpeed() (float64, error)
+	GetSpeedWithContext(ctx context.Context) (float64, error)
 	// The heading direction in degrees with respect to North direction, in clockwise order. That means North becomes 0 degree, East: 90 degrees, South: 180 degrees, West: 270 degrees and so on. When unknown, it's set to -1.0.
 	GetHeading() (float64, error)
+	GetHeadingWithContext(ctx context.Context) (float64, error)
 	//A human-readable description of the location, if available. WARNING: Applications should not rely on this property since not all sources provide a description. If you really need a description (or more details) about current location, use a reverse-geocoding API, e.g geocode-glib.
 	GetDescription() (string, error)
+	GetDescriptionWithContext(ctx context.Context) (string, error)
 	//The timestamp when the location was determined, in seconds and microseconds since the Epoch. This is the time of measurement if the backend provided that information, otherwise the time when Geoclue received the new location.
 	// Note that Geoclue can't guarantee that the timestamp will always monotonically increase, as a backend may not respect that. Also note that a timestamp can be very old, e.g. because of a cached location.
 	GetTimestamp() (time.Time, error)
+	GetTimestampWithContext(ctx context.Context) (time.Time, error)
+
+	// The altitude of the location fix in meters, ok is false when unknown.
+	Altitude() (value float64, ok bool, err error)
+	AltitudeWithContext(ctx context.Context) (value float64, ok bool, err error)
+	// The speed in meters per second, ok is false when unknown.
+	Speed() (value float64, ok bool, err error)
+	SpeedWithContext(ctx context.Context) (value float64, ok bool, err error)
+	// The heading direction in degrees with respect to North direction, ok is false when unknown.
+	Heading() (value float64, ok bool, err error)
+	HeadingWithContext(ctx context.Context) (value float64, ok bool, err error)
+
+	// Snapshot reads all properties with a single GetAll call, so the values are consistent with each other.
+	Snapshot(ctx context.Context) (Location, error)
+
+	// MarshalJSON encodes a snapshot of the location, with unknown altitude, speed and heading as null.
 	MarshalJSON() ([]byte, error)
 }
 
+// Values used by geoclue for unknown location fields
+const (
+	UnknownAltitude = -math.MaxFloat64
+	UnknownSpeed    = -1.0
+	UnknownHeading  = -1.0
+)
+
+// Location is a snapshot of all properties of a GeoclueLocation object.
+type Location struct {
+	// The latitude of the location, in degrees.
+	Latitude float64
+	// The longitude of the location, in degrees.
+	Longitude float64
+	// The accuracy of the location fix, in meters.
+	Accuracy float64
+	// The altitude of the location fix, in meters. When unknown, its set to minimum double value, -1.7976931348623157e+308.
+	Altitude float64
+	// The speed in meters per second. When unknown, it's set to -1.0.
+	Speed float64
+	// The heading direction in degrees with respect to North direction, in clockwise order. When unknown, it's set to -1.0.
+	Heading float64
+	// A human-readable description of the location, if available.
+	Description string
+	// The timestamp when the location was determined.
+	Timestamp time.Time
+}
+
+// Age returns how long ago the location was determined. Cached locations can be very old.
+func (l Location) Age() time.Duration {
+	return time.Since(l.Timestamp)
+}
+
+// HasAltitude reports whether the altitude is known.
+func (l Location) HasAltitude() bool {
+	return l.Altitude != UnknownAltitude
+}
+
+// HasSpeed reports whether the speed is known.
+func (l Location) HasSpeed() bool {
+	return l.Speed >= 0
+}
+
+// HasHeading reports whether the heading is known.
+func (l Location) HasHeading() bool {
+	return l.Heading >= 0
+}
+
+// MarshalJSON encodes the location, with unknown altitude, speed and heading as null.
+func (l Location) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]interface{}{
+		"Latitude":    l.Latitude,
+		"Longitude":   l.Longitude,
+		"Accuracy":    l.Accuracy,
+		"Altitude":    optionalFloat64(l.Altitude, l.HasAltitude()),
+		"Speed":       optionalFloat64(l.Speed, l.HasSpeed()),
+		"Heading":     optionalFloat64(l.Heading, l.HasHeading()),
+		"Description": l.Description,
+		"Timestamp":   l.Timestamp,
+	})
+}
+
+func optionalFloat64(value float64, ok bool) interface{} {
+	if !ok {
+		return nil
+	}
+	return value
+}
+
 // NewGeoclueLocation returns new NewGeoclueLocation Interface
-func NewGeoclueLocation(objectPath dbus.ObjectPath) (GeoclueLocation, error) {
+func NewGeoclueLocation(objectPath dbus.ObjectPath, opts ...Option) (GeoclueLocation, error) {
 	var gcl geoclueLocation
-	return &gcl, gcl.init(GeoclueInterface, objectPath)
+	return &gcl, gcl.init(GeoclueInterface, objectPath, opts...)
 }
 
 type geoclueLocation struct {
 	dbusBase
-	sigChan chan *dbus.Signal
 }
 
-func (gcl geoclueLocation) GetLatitude() (float64, error) {
-	v, err := gcl.getFloat64Property(GeoclueLocationPropertyLatitude)
+func (gcl *geoclueLocation) GetLatitude() (float64, error) {
+	return gcl.GetLatitudeWithContext(context.Background())
+}
+
+func (gcl *geoclueLocation) GetLatitudeWithContext(ctx context.Context) (float64, error) {
+	v, err := gcl.getFloat64Property(ctx, GeoclueLocationPropertyLatitude)
 	return v, err
 }
 
-func (gcl geoclueLocation) GetLongitude() (float64, error) {
-	v, err := gcl.getFloat64Property(GeoclueLocationPropertyLongitude)
+func (gcl *geoclueLocation) GetLongitude() (float64, error) {
+	return gcl.GetLongitudeWithContext(context.Background())
+}
+
+func (gcl *geoclueLocation) GetLongitudeWithContext(ctx context.Context) (float64, error) {
+	v, err := gcl.getFloat64Property(ctx, GeoclueLocationPropertyLongitude)
 	return v, err
 }
 
-func (gcl geoclueLocation) GetAccuracy() (float64, error) {
-	v, err := gcl.getFloat64Property(GeoclueLocationPropertyAccuracy)
+func (gcl *geoclueLocation) GetAccuracy() (float64, error) {
+	return gcl.GetAccuracyWithContext(context.Background())
+}
+
+func (gcl *geoclueLocation) GetAccuracyWithContext(ctx context.Context) (float64, error) {
+	v, err := gcl.getFloat64Property(ctx, GeoclueLocationPropertyAccuracy)
 	return v, err
 }
 
-func (gcl geoclueLocation) GetAltitude() (float64, error) {
-	v, err := gcl.getFloat64Property(GeoclueLocationPropertyAltitude)
+func (gcl *geoclueLocation) GetAltitude() (float64, error) {
+	return gcl.GetAltitudeWithContext(context.Background())
+}
+
+func (gcl *geoclueLocation) GetAltitudeWithContext(ctx context.Context) (float64, error) {
+	v, err := gcl.getFloat64Property(ctx, GeoclueLocationPropertyAltitude)
 	return v, err
 }
 
-func (gcl geoclueLocation) GetSpeed() (float64, error) {
-	v, err := gcl.getFloat64Property(GeoclueLocationPropertySpeed)
+func (gcl *geoclueLocation) GetSpeed() (float64, error) {
+	return gcl.GetSpeedWithContext(context.Background())
+}
+
+func (gcl *geoclueLocation) GetSpeedWithContext(ctx context.Context) (float64, error) {
+	v, err := gcl.getFloat64Property(ctx, GeoclueLocationPropertySpeed)
 	return v, err
 }
 
-func (gcl geoclueLocation) GetHeading() (float64, error) {
-	v, err := gcl.getFloat64Property(GeoclueLocationPropertyHeading)
+func (gcl *geoclueLocation) GetHeading() (float64, error) {
+	return gcl.GetHeadingWithContext(context.Background())
+}
+
+func (gcl *geoclueLocation) GetHeadingWithContext(ctx context.Context) (float64, error) {
+	v, err := gcl.getFloat64Property(ctx, GeoclueLocationPropertyHeading)
 	return v, err
 }
 
-func (gcl geoclueLocation) GetDescription() (string, error) {
-	v, err := gcl.getStringProperty(GeoclueLocationPropertyDescription)
+func (gcl *geoclueLocation) GetDescription() (string, error) {
+	return gcl.GetDescriptionWithContext(context.Background())
+}
+
+func (gcl *geoclueLocation) GetDescriptionWithContext(ctx context.Context) (string, error) {
+	v, err := gcl.getStringProperty(ctx, GeoclueLocationPropertyDescription)
 	return v, err
 }
 
-func (gcl geoclueLocation) GetTimestamp() (time.Time, error) {
-	v, err := gcl.getTimestampProperty(GeoclueLocationPropertyTimestamp)
+func (gcl *geoclueLocation) GetTimestamp() (time.Time, error) {
+	return gcl.GetTimestampWithContext(context.Background())
+}
+
+func (gcl *geoclueLocation) GetTimestampWithContext(ctx context.Context) (time.Time, error) {
+	v, err := gcl.getTimestampProperty(ctx, GeoclueLocationPropertyTimestamp)
 
 	return v, err
 }
 
-func (gcl geoclueLocation) MarshalJSON() ([]byte, error) {
-	latitude, err := gcl.GetLatitude()
-	if err != nil {
-		return nil, err
-	}
-	longitude, err := gcl.GetLongitude()
-	if err != nil {
-		return nil, err
-	}
-	accuracy, err := gcl.GetAccuracy()
+func (gcl *geoclueLocation) Altitude() (float64, bool, error) {
+	return gcl.AltitudeWithContext(context.Background())
+}
+
+func (gcl *geoclueLocation) AltitudeWithContext(ctx context.Context) (float64, bool, error) {
+	v, err := gcl.GetAltitudeWithContext(ctx)
 	if err != nil {
-		return nil, err
+		return 0, false, err
 	}
-	altitude, err := gcl.GetAltitude()
+	return v, Location{Altitude: v}.HasAltitude(), nil
+}
+
+func (gcl *geoclueLocation) Speed() (float64, bool, error) {
+	return gcl.SpeedWithContext(context.Background())
+}
+
+func (gcl *geoclueLocation) SpeedWithContext(ctx context.Context) (float64, bool, error) {
+	v, err := gcl.GetSpeedWithContext(ctx)
 	if err != nil {
-		return nil, err
+		return 0, false, err
 	}
+	return v, Location{Speed: v}.HasSpeed(), nil
+}
+
+func (gcl *geoclueLocation) Heading() (float64, bool, error) {
+	return gcl.HeadingWithContext(context.Background())
+}
 
-	heading, err := gcl.GetHeading()
+func (gcl *geoclueLocation) HeadingWithContext(ctx context.Context) (float64, bool, error) {
+	v, err := gcl.GetHeadingWithContext(ctx)
 	if err != nil {
-		return nil, err
+		return 0, false, err
 	}
+	return v, Location{Heading: v}.HasHeading(), nil
+}
 
-	description, err := gcl.GetDescription()
+func (gcl *geoclueLocation) Snapshot(ctx context.Context) (loc Location, err error) {
+	props, err := gcl.getAllProperties(ctx, GeoclueLocationInterface)
 	if err != nil {
-		return nil, err
+		return
+	}
+	for property, field := range map[string]*float64{
+		GeoclueLocationPropertyLatitude:  &loc.Latitude,
+		GeoclueLocationPropertyLongitude: &loc.Longitude,
+		GeoclueLocationPropertyAccuracy:  &loc.Accuracy,
+		GeoclueLocationPropertyAltitude:  &loc.Altitude,
+		GeoclueLocationPropertySpeed:     &loc.Speed,
+		GeoclueLocationPropertyHeading:   &loc.Heading,
+	} {
+		var ok bool
+		*field, ok = props[strings.TrimPrefix(property, GeoclueLocationInterface+".")].Value().(float64)
+		if !ok {
+			err = makeErrVariantType(property)
+			return
+		}
+	}
+	var ok bool
+	loc.Description, ok = props["Description"].Value().(string)
+	if !ok {
+		err = makeErrVariantType(GeoclueLocationPropertyDescription)
+		return
 	}
+	loc.Timestamp, err = parseTimestamp(GeoclueLocationPropertyTimestamp, props["Timestamp"].Value())
+	return
+}
 
-	timestamp, err := gcl.GetTimestamp()
+func (gcl *geoclueLocation) MarshalJSON() ([]byte, error) {
+	loc, err := gcl.Snapshot(context.Background())
 	if err != nil {
 		return nil, err
 	}
-
-	return json.Marshal(map[string]interface{}{
-		"Latitude":    latitude,
-		"Longitude":   longitude,
-		"Accuracy":    accuracy,
-		"Altitude":    altitude,
-		"Heading":     heading,
-		"Description": description,
-		"Timestamp":   timestamp,
-	})
+	return loc.MarshalJSON()
 }
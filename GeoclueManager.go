@@ -1,9 +1,10 @@
 package geoclue2
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"github.com/godbus/dbus/v5"
-	"log"
 )
 
 // Paths of methods and properties
@@ -28,94 +29,222 @@ const (
 // The only thing you do with this interface is to call GetClient() or CreateClient() on it to get your application specific client object(s).
 type GeoclueManager interface {
 	/* METHODS */
+	// Every method has a ...WithContext variant, which passes the context to the underlying D-Bus call
+	// so cancellation and deadlines are honored.
 
 	// Retrieves a client object which can only be used by the calling application only.
 	// On the first call from a specific D-Bus peer, this method will create the client object but subsequent
 	// calls will return the path of the existing client.
 	GetClient() (GeoclueClient, error)
+	GetClientWithContext(ctx context.Context) (GeoclueClient, error)
 
 	// Creates and retrieves a client object which can only be used by the calling application only.
 	// Unlike GetClient(), this method always creates a new client.
 	CreateClient() (GeoclueClient, error)
+	CreateClientWithContext(ctx context.Context) (GeoclueClient, error)
 
 	// Use this method to explicitly destroy a client, created using GetClient() or CreateClient().
 	// Long-running applications, should either use this to delete associated client(s) when not needed,
 	// or disconnect from the D-Bus connection used for communicating with Geoclue (which is implicit
 	// on client process termination).
 	DeleteClient(GeoclueClient) error
+	DeleteClientWithContext(ctx context.Context, gcc GeoclueClient) error
+
+	// Open validates the configuration, creates or gets a client, applies the desktop id, accuracy level and
+	// thresholds in this order and starts the client. If a step fails, the client is closed again.
+	// Watch() of the returned client sends the current location first, so the first location is not missed.
+	// Close() of the returned client stops it and deletes it, unless ClientConfig.Shared is set.
+	Open(ctx context.Context, cfg ClientConfig) (GeoclueClientCloser, error)
 
 	// An API for user authorization agents to register themselves. Each agent is responsible for the user
 	// it is running as. Application developers can and should simply ignore this API.
 	// IN s id: The Desktop ID (excluding .desktop) of the agent
 	AddAgent(id string) error
+	AddAgentWithContext(ctx context.Context, id string) error
 
 	/* PROPERTIES */
 
 	// Whether service is currently is use by any application.
 	InUse() (bool, error)
+	InUseWithContext(ctx context.Context) (bool, error)
 	// The level of available accuracy, as GClueAccuracyLevel.
 	GetAvailableAccuracyLevel() (GClueAccuracyLevel, error)
+	GetAvailableAccuracyLevelWithContext(ctx context.Context) (GClueAccuracyLevel, error)
+
+	// WatchProperties subscribes to the PropertiesChanged signal of the manager and sends an event whenever
+	// InUse or AvailableAccuracyLevel change. The channel is closed when ctx is done.
+	WatchProperties(ctx context.Context) (<-chan ManagerEvent, error)
 
 	MarshalJSON() ([]byte, error)
 }
 
+// ManagerEvent is sent by WatchProperties() for every change of the manager properties.
+type ManagerEvent struct {
+	// The new value of InUse, nil if it did not change.
+	InUse *bool
+	// The new value of AvailableAccuracyLevel, nil if it did not change.
+	AvailableAccuracyLevel *GClueAccuracyLevel
+	// Set if the signal or an invalidated property could not be read, the other fields are not valid then.
+	Err error
+}
+
 // NewGeoclueManager returns new GeoclueManager Interface
-func NewGeoclueManager() (GeoclueManager, error) {
+func NewGeoclueManager(opts ...Option) (GeoclueManager, error) {
 	var gcm geoclueManager
 
-	return &gcm, gcm.init(GeoclueInterface, GeoclueManagerObjectPath)
+	return &gcm, gcm.init(GeoclueInterface, GeoclueManagerObjectPath, opts...)
 }
 
 type geoclueManager struct {
 	dbusBase
 }
 
-func (gcm geoclueManager) GetAvailableAccuracyLevel() (GClueAccuracyLevel, error) {
-	v, err := gcm.getUint32Property(GeoclueManagerPropertyAvailableAccuracyLevel)
+func (gcm *geoclueManager) GetAvailableAccuracyLevel() (GClueAccuracyLevel, error) {
+	return gcm.GetAvailableAccuracyLevelWithContext(context.Background())
+}
+
+func (gcm *geoclueManager) GetAvailableAccuracyLevelWithContext(ctx context.Context) (GClueAccuracyLevel, error) {
+	v, err := gcm.getUint32Property(ctx, GeoclueManagerPropertyAvailableAccuracyLevel)
 	return GClueAccuracyLevel(v), err
 }
 
-func (gcm geoclueManager) InUse() (bool, error) {
-	v, err := gcm.getBoolProperty(GeoclueManagerPropertyInUse)
+func (gcm *geoclueManager) InUse() (bool, error) {
+	return gcm.InUseWithContext(context.Background())
+}
+
+func (gcm *geoclueManager) InUseWithContext(ctx context.Context) (bool, error) {
+	v, err := gcm.getBoolProperty(ctx, GeoclueManagerPropertyInUse)
 	return v, err
 
 }
 
-func (gcm geoclueManager) GetClient() (GeoclueClient, error) {
+func (gcm *geoclueManager) WatchProperties(ctx context.Context) (<-chan ManagerEvent, error) {
+	sub, err := gcm.subscribeSignal(dbusPropertiesInterface, dbusSignalPropertiesChanged)
+	if err != nil {
+		return nil, err
+	}
+
+	events := make(chan ManagerEvent)
+	go func() {
+		defer close(events)
+		defer sub.Close()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case v, ok := <-sub.C:
+				if !ok {
+					return
+				}
+				event, ok := gcm.readManagerEvent(ctx, v)
+				if !ok {
+					continue
+				}
+				select {
+				case events <- event:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return events, nil
+}
+
+// readManagerEvent parses a PropertiesChanged signal, invalidated properties are read again.
+// It returns false if the signal does not change InUse or AvailableAccuracyLevel.
+func (gcm *geoclueManager) readManagerEvent(ctx context.Context, v *dbus.Signal) (event ManagerEvent, ok bool) {
+	iface, changed, invalidated, err := gcm.parsePropertiesChanged(v)
+	if err != nil {
+		return ManagerEvent{Err: err}, true
+	}
+	if iface != GeoclueManagerInterface {
+		return event, false
+	}
+	if value, found := changed["InUse"]; found {
+		inUse, isBool := value.Value().(bool)
+		if !isBool {
+			return ManagerEvent{Err: errors.New("error by parsing InUse")}, true
+		}
+		event.InUse = &inUse
+	}
+	if value, found := changed["AvailableAccuracyLevel"]; found {
+		level, isUint32 := value.Value().(uint32)
+		if !isUint32 {
+			return ManagerEvent{Err: errors.New("error by parsing AvailableAccuracyLevel")}, true
+		}
+		accuracyLevel := GClueAccuracyLevel(level)
+		event.AvailableAccuracyLevel = &accuracyLevel
+	}
+	for _, name := range invalidated {
+		switch name {
+		case "InUse":
+			inUse, err := gcm.InUseWithContext(ctx)
+			if err != nil {
+				return ManagerEvent{Err: err}, true
+			}
+			event.InUse = &inUse
+		case "AvailableAccuracyLevel":
+			level, err := gcm.GetAvailableAccuracyLevelWithContext(ctx)
+			if err != nil {
+				return ManagerEvent{Err: err}, true
+			}
+			event.AvailableAccuracyLevel = &level
+		}
+	}
+	return event, event.InUse != nil || event.AvailableAccuracyLevel != nil
+}
+
+func (gcm *geoclueManager) GetClient() (GeoclueClient, error) {
+	return gcm.GetClientWithContext(context.Background())
+}
+
+func (gcm *geoclueManager) GetClientWithContext(ctx context.Context) (GeoclueClient, error) {
 	var clientPath dbus.ObjectPath
-	err := gcm.callWithReturn(&clientPath, GeoclueManagerGetClient)
+	err := gcm.callWithReturn(ctx, &clientPath, GeoclueManagerGetClient)
 	if err != nil {
-		log.Fatal(err.Error())
+		return nil, err
 	}
-	gcc, err := NewGeoclueClient(clientPath)
+	gcc, err := NewGeoclueClient(clientPath, WithConn(gcm.conn))
 
 	return gcc, err
 }
 
-func (gcm geoclueManager) CreateClient() (GeoclueClient, error) {
+func (gcm *geoclueManager) CreateClient() (GeoclueClient, error) {
+	return gcm.CreateClientWithContext(context.Background())
+}
+
+func (gcm *geoclueManager) CreateClientWithContext(ctx context.Context) (GeoclueClient, error) {
 	var clientPath dbus.ObjectPath
-	err := gcm.callWithReturn(&clientPath, GeoclueManagerCreateClient)
+	err := gcm.callWithReturn(ctx, &clientPath, GeoclueManagerCreateClient)
 	if err != nil {
-		log.Fatal(err.Error())
+		return nil, err
 	}
-	gcc, err := NewGeoclueClient(clientPath)
+	gcc, err := NewGeoclueClient(clientPath, WithConn(gcm.conn))
 
 	return gcc, err
 }
 
-func (gcm geoclueManager) DeleteClient(gcc GeoclueClient) error {
-	err := gcm.call(GeoclueManagerDeleteClient, &gcc)
-	if err != nil {
-		return err
+func (gcm *geoclueManager) DeleteClient(gcc GeoclueClient) error {
+	return gcm.DeleteClientWithContext(context.Background(), gcc)
+}
+
+func (gcm *geoclueManager) DeleteClientWithContext(ctx context.Context, gcc GeoclueClient) error {
+	if gcc == nil {
+		return ErrInvalidArgs
 	}
-	return err
+	return gcm.call(ctx, GeoclueManagerDeleteClient, gcc.ObjectPath())
+}
+
+func (gcm *geoclueManager) AddAgent(id string) error {
+	return gcm.AddAgentWithContext(context.Background(), id)
 }
 
-func (gcm geoclueManager) AddAgent(id string) error {
-	return gcm.call(GeoclueManagerAddAgent, id)
+func (gcm *geoclueManager) AddAgentWithContext(ctx context.Context, id string) error {
+	return gcm.call(ctx, GeoclueManagerAddAgent, id)
 }
 
-func (gcm geoclueManager) MarshalJSON() ([]byte, error) {
+func (gcm *geoclueManager) MarshalJSON() ([]byte, error) {
 	inUse, err := gcm.InUse()
 	if err != nil {
 		return nil, err
@@ -126,7 +255,7 @@ func (gcm geoclueManager) MarshalJSON() ([]byte, error) {
 	}
 
 	return json.Marshal(map[string]interface{}{
-		"InUse":                   inUse,
-		"AvailableAccuracyLevel ": availableAccuracyLevel,
+		"InUse":                  inUse,
+		"AvailableAccuracyLevel": availableAccuracyLevel,
 	})
 }
@@ -0,0 +1,178 @@
+package geoclue2_test
+
+import (
+	"errors"
+	"github.com/godbus/dbus/v5"
+	"github.com/maltegrosse/go-geoclue2"
+	"testing"
+	"time"
+)
+
+func TestAvailableAccuracyLevel(t *testing.T) {
+	f := newFake(t)
+	defer f.close()
+	gcm := f.manager(t)
+
+	f.srv.SetAvailableAccuracyLevel(geoclue2.GClueAccuracyLevelCity)
+	level, err := gcm.GetAvailableAccuracyLevel()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if level != geoclue2.GClueAccuracyLevelCity {
+		t.Errorf("GetAvailableAccuracyLevel() = %v, want %v", level, geoclue2.GClueAccuracyLevelCity)
+	}
+
+	// a client requesting more than available is capped by the service, the requested level stays
+	gcc := newClient(t, gcm, "test")
+	if err := gcc.Start(); err != nil {
+		t.Fatal(err)
+	}
+	state, ok := f.srv.Client(gcc.ObjectPath())
+	if !ok {
+		t.Fatalf("client %s not found", gcc.ObjectPath())
+	}
+	if state.AllowedAccuracyLevel != geoclue2.GClueAccuracyLevelCity {
+		t.Errorf("allowed accuracy level = %v, want %v", state.AllowedAccuracyLevel, geoclue2.GClueAccuracyLevelCity)
+	}
+	requested, err := gcc.GetRequestedAccuracyLevel()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if requested != geoclue2.GClueAccuracyLevelExact {
+		t.Errorf("GetRequestedAccuracyLevel() = %v, want %v", requested, geoclue2.GClueAccuracyLevelExact)
+	}
+}
+
+func TestDeleteClient(t *testing.T) {
+	f := newFake(t)
+	defer f.close()
+	gcm := f.manager(t)
+
+	gcc, err := gcm.CreateClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := gcm.CreateClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if clients := f.srv.Clients(); len(clients) != 2 {
+		t.Fatalf("%d clients after CreateClient(), want 2", len(clients))
+	}
+	if err := gcm.DeleteClient(gcc); err != nil {
+		t.Fatal(err)
+	}
+	clients := f.srv.Clients()
+	if len(clients) != 1 || clients[0].Path != other.ObjectPath() {
+		t.Errorf("clients after DeleteClient() %+v, want only %s", clients, other.ObjectPath())
+	}
+	if err := gcm.DeleteClient(other); err != nil {
+		t.Fatal(err)
+	}
+	if clients := f.srv.Clients(); len(clients) != 0 {
+		t.Errorf("%d clients after deleting all, want 0", len(clients))
+	}
+	if err := gcm.DeleteClient(nil); !errors.Is(err, geoclue2.ErrInvalidArgs) {
+		t.Errorf("DeleteClient(nil) = %v, want ErrInvalidArgs", err)
+	}
+}
+
+func TestDeleteClientOfOtherPeer(t *testing.T) {
+	f := newFake(t)
+	defer f.close()
+
+	gcc, err := f.manager(t).CreateClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the client object as seen by another peer
+	conn := f.dial(t)
+	foreign, err := geoclue2.NewGeoclueClient(gcc.ObjectPath(), geoclue2.WithConn(conn))
+	if err != nil {
+		t.Fatal(err)
+	}
+	gcm, err := geoclue2.NewGeoclueManager(geoclue2.WithConn(conn))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := gcm.DeleteClient(foreign); !errors.Is(err, geoclue2.ErrAccessDenied) {
+		t.Errorf("DeleteClient() of another peer's client = %v, want ErrAccessDenied", err)
+	}
+	if clients := f.srv.Clients(); len(clients) != 1 {
+		t.Errorf("%d clients after the denied DeleteClient(), want 1", len(clients))
+	}
+}
+
+// nextManagerEvent returns the next event of WatchProperties().
+func nextManagerEvent(t *testing.T, events <-chan geoclue2.ManagerEvent) geoclue2.ManagerEvent {
+	t.Helper()
+	select {
+	case event, ok := <-events:
+		if !ok {
+			t.Fatal("events closed")
+		}
+		if event.Err != nil {
+			t.Fatal(event.Err)
+		}
+		return event
+	case <-time.After(timeout):
+		t.Fatal("no manager event")
+	}
+	return geoclue2.ManagerEvent{}
+}
+
+func TestWatchProperties(t *testing.T) {
+	f := newFake(t)
+	defer f.close()
+	gcm := f.manager(t)
+
+	ctx, cancel := contextWithTimeout()
+	defer cancel()
+	events, err := gcm.WatchProperties(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// starting and stopping the only client changes InUse
+	gcc := newClient(t, gcm, "test")
+	if err := gcc.Start(); err != nil {
+		t.Fatal(err)
+	}
+	if event := nextManagerEvent(t, events); event.InUse == nil || !*event.InUse || event.AvailableAccuracyLevel != nil {
+		t.Errorf("event after Start() %+v, want InUse true", event)
+	}
+	if err := gcc.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	if event := nextManagerEvent(t, events); event.InUse == nil || *event.InUse {
+		t.Errorf("event after Stop() %+v, want InUse false", event)
+	}
+
+	f.srv.SetAvailableAccuracyLevel(geoclue2.GClueAccuracyLevelCity)
+	event := nextManagerEvent(t, events)
+	if event.AvailableAccuracyLevel == nil || *event.AvailableAccuracyLevel != geoclue2.GClueAccuracyLevelCity || event.InUse != nil {
+		t.Errorf("event %+v, want AvailableAccuracyLevel %v", event, geoclue2.GClueAccuracyLevelCity)
+	}
+
+	// signals of other interfaces are skipped, invalidated properties are read again
+	srvConn := f.conns[0]
+	err = srvConn.Emit(geoclue2.GeoclueManagerObjectPath, "org.freedesktop.DBus.Properties.PropertiesChanged",
+		"org.example.Other", map[string]dbus.Variant{"InUse": dbus.MakeVariant(true)}, []string{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = srvConn.Emit(geoclue2.GeoclueManagerObjectPath, "org.freedesktop.DBus.Properties.PropertiesChanged",
+		geoclue2.GeoclueManagerInterface, map[string]dbus.Variant{}, []string{"InUse", "AvailableAccuracyLevel"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	event = nextManagerEvent(t, events)
+	if event.InUse == nil || *event.InUse || event.AvailableAccuracyLevel == nil ||
+		*event.AvailableAccuracyLevel != geoclue2.GClueAccuracyLevelCity {
+		t.Errorf("event for the invalidated properties %+v, want the current values", event)
+	}
+
+	cancel()
+	for range events {
+	}
+}
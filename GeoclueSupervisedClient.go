@@ -0,0 +1,448 @@
+package geoclue2
+
+import (
+	"context"
+	"errors"
+	"github.com/godbus/dbus/v5"
+	"sync"
+	"time"
+)
+
+// ReconnectTimeout limits the D-Bus calls to re-create the client after geoclue restarted.
+const ReconnectTimeout = 25 * time.Second
+
+// ErrClosed is returned by a GeoclueSupervisedClient after Close was called.
+var ErrClosed = errors.New("client closed")
+
+// maxQueuedEvents limits the events queued for a channel returned by GeoclueSupervisedClient.Watch(), whose
+// receiver does not keep up. When the limit is reached, the oldest event is dropped.
+const maxQueuedEvents = 1024
+
+// GeoclueSupervisedClient is a client which survives restarts of the geoclue daemon. Geoclue is D-Bus activated
+// and exits when idle, which removes all client objects, so a plain GeoclueClient returns UnknownObject errors
+// afterwards. The supervised client watches the owner of the org.freedesktop.GeoClue2 name and re-creates its
+// client with GetClient(). The desktop id, requested accuracy level and thresholds set before are applied again,
+// the client is restarted if it was started, and the channels returned by Watch resume with the new client.
+type GeoclueSupervisedClient interface {
+	// The current client object. It is replaced when geoclue restarts, so it should not be kept.
+	Client() GeoclueClient
+
+	// Starts, or restarts after a reconnection, the client.
+	Start() error
+	StartWithContext(ctx context.Context) error
+	// Stops the client, it is not restarted after a reconnection.
+	Stop() error
+	StopWithContext(ctx context.Context) error
+
+	// The setters are applied to the current client and remembered for reconnections.
+	SetDesktopId(value string) error
+	SetDesktopIdWithContext(ctx context.Context, value string) error
+	SetRequestedAccuracyLevel(level GClueAccuracyLevel) error
+	SetRequestedAccuracyLevelWithContext(ctx context.Context, level GClueAccuracyLevel) error
+	SetDistanceThreshold(value uint32) error
+	SetDistanceThresholdWithContext(ctx context.Context, value uint32) error
+	SetTimeThreshold(value uint32) error
+	SetTimeThresholdWithContext(ctx context.Context, value uint32) error
+
+	// Watch is like GeoclueClient.Watch(), but continues with the new client after a reconnection.
+	// Failed reconnections are reported as events with Err set, the next owner change of the service is
+	// tried again. The channel is closed when ctx is done or the supervised client is closed.
+	Watch(ctx context.Context) (<-chan LocationEvent, error)
+
+	// Stops supervising, stops and deletes the client, waiting at most RollbackTimeout for the service, and
+	// closes the channels returned by Watch.
+	Close() error
+}
+
+// NewGeoclueSupervisedClient creates a client with GetClient() and starts supervising the geoclue service.
+func NewGeoclueSupervisedClient(opts ...Option) (GeoclueSupervisedClient, error) {
+	return NewGeoclueSupervisedClientWithContext(context.Background(), opts...)
+}
+
+// NewGeoclueSupervisedClientWithContext is like NewGeoclueSupervisedClient() but uses ctx for creating the first client.
+func NewGeoclueSupervisedClientWithContext(ctx context.Context, opts ...Option) (GeoclueSupervisedClient, error) {
+	gcm, err := NewGeoclueManager(opts...)
+	if err != nil {
+		return nil, err
+	}
+	conn := gcm.(*geoclueManager).conn
+	sub, err := getDispatcher(conn).subscribe(ownerFilter(GeoclueInterface))
+	if err != nil {
+		return nil, err
+	}
+	gsc := &geoclueSupervisedClient{
+		conn:     conn,
+		manager:  gcm,
+		ownerSub: sub,
+		watchers: make(map[*supervisedWatcher]struct{}),
+	}
+	gsc.mu.Lock()
+	err = gsc.connect(ctx)
+	gsc.mu.Unlock()
+	if err != nil {
+		sub.Close()
+		return nil, err
+	}
+	go gsc.supervise()
+	return gsc, nil
+}
+
+// supervisedWatcher is a channel returned by Watch. The events are queued and sent by its own goroutine,
+// so a receiver which does not keep up does not block the supervisor and the other watchers.
+type supervisedWatcher struct {
+	gsc  *geoclueSupervisedClient
+	ctx  context.Context
+	c    chan LocationEvent
+	done chan struct{}
+	once sync.Once
+
+	mu     sync.Mutex
+	queue  []LocationEvent
+	queued chan struct{}
+}
+
+// deliver queues the event without blocking.
+func (w *supervisedWatcher) deliver(event LocationEvent) {
+	w.mu.Lock()
+	if len(w.queue) == maxQueuedEvents {
+		w.queue[0] = LocationEvent{}
+		w.queue = w.queue[1:]
+	}
+	w.queue = append(w.queue, event)
+	w.mu.Unlock()
+	select {
+	case w.queued <- struct{}{}:
+	default:
+	}
+}
+
+// run sends the queued events on c until ctx is done or the watcher is closed, then closes c.
+func (w *supervisedWatcher) run() {
+	defer close(w.c)
+	for {
+		w.mu.Lock()
+		if len(w.queue) == 0 {
+			w.mu.Unlock()
+			select {
+			case <-w.queued:
+				continue
+			case <-w.ctx.Done():
+				w.gsc.removeWatcher(w)
+				return
+			case <-w.done:
+				return
+			}
+		}
+		event := w.queue[0]
+		w.queue[0] = LocationEvent{}
+		w.queue = w.queue[1:]
+		w.mu.Unlock()
+		select {
+		case w.c <- event:
+		case <-w.ctx.Done():
+			w.gsc.removeWatcher(w)
+			return
+		case <-w.done:
+			return
+		}
+	}
+}
+
+func (w *supervisedWatcher) close() {
+	w.once.Do(func() {
+		close(w.done)
+	})
+}
+
+type geoclueSupervisedClient struct {
+	conn     *dbus.Conn
+	manager  GeoclueManager
+	ownerSub *signalSubscription
+
+	// mu serializes the D-Bus calls changing the client with reconnections
+	mu      sync.Mutex
+	client  GeoclueClient
+	owner   string
+	cancel  context.CancelFunc
+	config  ClientConfig // the settings, applied again to every new client
+	started bool
+	closed  bool
+
+	watchersMu sync.Mutex
+	watchers   map[*supervisedWatcher]struct{}
+}
+
+// connect creates the client, applies the settings, forwards its location updates and starts it if requested.
+// mu must be held.
+func (gsc *geoclueSupervisedClient) connect(ctx context.Context) error {
+	client, err := gsc.manager.GetClientWithContext(ctx)
+	if err != nil {
+		return err
+	}
+	var owner string
+	err = gsc.conn.BusObject().CallWithContext(ctx, dbusMethodGetNameOwner, 0, GeoclueInterface).Store(&owner)
+	if err != nil {
+		return makeError(err)
+	}
+	if err := gsc.config.apply(ctx, client); err != nil {
+		return err
+	}
+	watchCtx, cancel := context.WithCancel(context.Background())
+	events, err := client.Watch(watchCtx)
+	if err != nil {
+		cancel()
+		return err
+	}
+	if gsc.started {
+		if err := client.StartWithContext(ctx); err != nil {
+			cancel()
+			return err
+		}
+	}
+	gsc.disconnect()
+	gsc.client, gsc.owner, gsc.cancel = client, owner, cancel
+	go gsc.forward(events)
+	return nil
+}
+
+// disconnect stops forwarding the location updates of the current client. mu must be held.
+func (gsc *geoclueSupervisedClient) disconnect() {
+	if gsc.cancel != nil {
+		gsc.cancel()
+	}
+	gsc.client, gsc.owner, gsc.cancel = nil, "", nil
+}
+
+// supervise reconnects when the owner of the service changes.
+func (gsc *geoclueSupervisedClient) supervise() {
+	for v := range gsc.ownerSub.C {
+		if len(v.Body) != 3 {
+			continue
+		}
+		newOwner, _ := v.Body[2].(string)
+		gsc.mu.Lock()
+		if gsc.closed || (newOwner != "" && newOwner == gsc.owner) {
+			// the service was activated by our own GetClient() call
+			gsc.mu.Unlock()
+			continue
+		}
+		gsc.disconnect()
+		var err error
+		// when another instance of the service took over, the client is re-created right away. When the service
+		// exited, a started client is re-created right away, which activates the service again, and a stopped
+		// one on next use.
+		if newOwner != "" || gsc.started {
+			ctx, cancel := context.WithTimeout(context.Background(), ReconnectTimeout)
+			err = gsc.connect(ctx)
+			cancel()
+		}
+		gsc.mu.Unlock()
+		if err != nil {
+			gsc.broadcast(LocationEvent{Err: err})
+		}
+	}
+}
+
+// forward delivers the location updates of a client to the watchers, until its watch context is canceled.
+func (gsc *geoclueSupervisedClient) forward(events <-chan LocationEvent) {
+	for event := range events {
+		gsc.broadcast(event)
+	}
+}
+
+func (gsc *geoclueSupervisedClient) broadcast(event LocationEvent) {
+	gsc.watchersMu.Lock()
+	watchers := make([]*supervisedWatcher, 0, len(gsc.watchers))
+	for w := range gsc.watchers {
+		watchers = append(watchers, w)
+	}
+	gsc.watchersMu.Unlock()
+	for _, w := range watchers {
+		w.deliver(event)
+	}
+}
+
+// current returns the client, re-creating it if geoclue exited in the meantime. mu must be held.
+func (gsc *geoclueSupervisedClient) current(ctx context.Context) (GeoclueClient, error) {
+	if gsc.closed {
+		return nil, ErrClosed
+	}
+	if gsc.client == nil {
+		if err := gsc.connect(ctx); err != nil {
+			return nil, err
+		}
+	}
+	return gsc.client, nil
+}
+
+func (gsc *geoclueSupervisedClient) Client() GeoclueClient {
+	gsc.mu.Lock()
+	defer gsc.mu.Unlock()
+	return gsc.client
+}
+
+func (gsc *geoclueSupervisedClient) Start() error {
+	return gsc.StartWithContext(context.Background())
+}
+
+func (gsc *geoclueSupervisedClient) StartWithContext(ctx context.Context) error {
+	gsc.mu.Lock()
+	defer gsc.mu.Unlock()
+	client, err := gsc.current(ctx)
+	if err != nil {
+		return err
+	}
+	err = client.StartWithContext(ctx)
+	if err != nil {
+		return err
+	}
+	gsc.started = true
+	return nil
+}
+
+func (gsc *geoclueSupervisedClient) Stop() error {
+	return gsc.StopWithContext(context.Background())
+}
+
+func (gsc *geoclueSupervisedClient) StopWithContext(ctx context.Context) error {
+	gsc.mu.Lock()
+	defer gsc.mu.Unlock()
+	if gsc.closed {
+		return ErrClosed
+	}
+	gsc.started = false
+	if gsc.client == nil {
+		return nil
+	}
+	return gsc.client.StopWithContext(ctx)
+}
+
+func (gsc *geoclueSupervisedClient) SetDesktopId(value string) error {
+	return gsc.SetDesktopIdWithContext(context.Background(), value)
+}
+
+func (gsc *geoclueSupervisedClient) SetDesktopIdWithContext(ctx context.Context, value string) error {
+	gsc.mu.Lock()
+	defer gsc.mu.Unlock()
+	client, err := gsc.current(ctx)
+	if err != nil {
+		return err
+	}
+	err = client.SetDesktopIdWithContext(ctx, value)
+	if err != nil {
+		return err
+	}
+	gsc.config.DesktopId = value
+	return nil
+}
+
+func (gsc *geoclueSupervisedClient) SetRequestedAccuracyLevel(level GClueAccuracyLevel) error {
+	return gsc.SetRequestedAccuracyLevelWithContext(context.Background(), level)
+}
+
+func (gsc *geoclueSupervisedClient) SetRequestedAccuracyLevelWithContext(ctx context.Context, level GClueAccuracyLevel) error {
+	gsc.mu.Lock()
+	defer gsc.mu.Unlock()
+	client, err := gsc.current(ctx)
+	if err != nil {
+		return err
+	}
+	err = client.SetRequestedAccuracyLevelWithContext(ctx, level)
+	if err != nil {
+		return err
+	}
+	gsc.config.RequestedAccuracyLevel = level
+	return nil
+}
+
+func (gsc *geoclueSupervisedClient) SetDistanceThreshold(value uint32) error {
+	return gsc.SetDistanceThresholdWithContext(context.Background(), value)
+}
+
+func (gsc *geoclueSupervisedClient) SetDistanceThresholdWithContext(ctx context.Context, value uint32) error {
+	gsc.mu.Lock()
+	defer gsc.mu.Unlock()
+	client, err := gsc.current(ctx)
+	if err != nil {
+		return err
+	}
+	err = client.SetDistanceThresholdWithContext(ctx, value)
+	if err != nil {
+		return err
+	}
+	gsc.config.DistanceThreshold = value
+	return nil
+}
+
+func (gsc *geoclueSupervisedClient) SetTimeThreshold(value uint32) error {
+	return gsc.SetTimeThresholdWithContext(context.Background(), value)
+}
+
+func (gsc *geoclueSupervisedClient) SetTimeThresholdWithContext(ctx context.Context, value uint32) error {
+	gsc.mu.Lock()
+	defer gsc.mu.Unlock()
+	client, err := gsc.current(ctx)
+	if err != nil {
+		return err
+	}
+	err = client.SetTimeThresholdWithContext(ctx, value)
+	if err != nil {
+		return err
+	}
+	gsc.config.TimeThreshold = value
+	return nil
+}
+
+func (gsc *geoclueSupervisedClient) Watch(ctx context.Context) (<-chan LocationEvent, error) {
+	gsc.mu.Lock()
+	closed := gsc.closed
+	gsc.mu.Unlock()
+	if closed {
+		return nil, ErrClosed
+	}
+	w := &supervisedWatcher{
+		gsc:    gsc,
+		ctx:    ctx,
+		c:      make(chan LocationEvent),
+		done:   make(chan struct{}),
+		queued: make(chan struct{}, 1),
+	}
+	gsc.watchersMu.Lock()
+	gsc.watchers[w] = struct{}{}
+	gsc.watchersMu.Unlock()
+	go w.run()
+	return w.c, nil
+}
+
+func (gsc *geoclueSupervisedClient) removeWatcher(w *supervisedWatcher) {
+	gsc.watchersMu.Lock()
+	delete(gsc.watchers, w)
+	gsc.watchersMu.Unlock()
+	w.close()
+}
+
+func (gsc *geoclueSupervisedClient) Close() error {
+	gsc.mu.Lock()
+	if gsc.closed {
+		gsc.mu.Unlock()
+		return ErrClosed
+	}
+	gsc.closed = true
+	client := gsc.client
+	gsc.disconnect()
+	gsc.mu.Unlock()
+	gsc.ownerSub.Close()
+
+	gsc.watchersMu.Lock()
+	watchers := gsc.watchers
+	gsc.watchers = make(map[*supervisedWatcher]struct{})
+	gsc.watchersMu.Unlock()
+	for w := range watchers {
+		w.close()
+	}
+
+	if client == nil {
+		return nil
+	}
+	return closeClient(gsc.manager, client, false)
+}
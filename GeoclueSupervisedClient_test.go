@@ -0,0 +1,104 @@
+package geoclue2_test
+
+import (
+	"github.com/maltegrosse/go-geoclue2"
+	"github.com/maltegrosse/go-geoclue2/geoclue2test"
+	"testing"
+	"time"
+)
+
+// nextLocation returns the next event without error, skipping the errors of failed reconnections.
+func nextLocation(t *testing.T, events <-chan geoclue2.LocationEvent) geoclue2.Location {
+	t.Helper()
+	deadline := time.After(timeout)
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				t.Fatal("events closed")
+			}
+			if event.Err == nil {
+				return event.New
+			}
+		case <-deadline:
+			t.Fatal("no location event")
+		}
+	}
+}
+
+func TestSupervisedClientRestart(t *testing.T) {
+	f := newFake(t)
+	defer f.close()
+
+	gsc, err := geoclue2.NewGeoclueSupervisedClient(geoclue2.WithConn(f.dial(t)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer gsc.Close()
+	if err := gsc.SetDesktopId("supervised"); err != nil {
+		t.Fatal(err)
+	}
+	if err := gsc.SetRequestedAccuracyLevel(geoclue2.GClueAccuracyLevelCity); err != nil {
+		t.Fatal(err)
+	}
+	if err := gsc.SetDistanceThreshold(5); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := contextWithTimeout()
+	defer cancel()
+	// a watcher which is never read must not block the supervisor and the other watchers
+	if _, err := gsc.Watch(ctx); err != nil {
+		t.Fatal(err)
+	}
+	events, err := gsc.Watch(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := gsc.Start(); err != nil {
+		t.Fatal(err)
+	}
+	f.srv.SetLocation(geoclue2test.NewLocation(1, 2, 10))
+	if l := nextLocation(t, events); l.Latitude != 1 {
+		t.Errorf("latitude %v, want 1", l.Latitude)
+	}
+
+	// restart the service: the old instance releases the name and a new one takes it over
+	if err := f.srv.Close(); err != nil {
+		t.Fatal(err)
+	}
+	srv, err := geoclue2test.NewService(f.dial(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.SetLocation(geoclue2test.NewLocation(3, 4, 10))
+	var clients []geoclue2test.ClientState
+	for deadline := time.Now().Add(timeout); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		clients = srv.Clients()
+		if len(clients) == 1 && clients[0].Active {
+			break
+		}
+	}
+	if len(clients) != 1 {
+		t.Fatalf("%d clients after the restart, want 1", len(clients))
+	}
+	client := clients[0]
+	if !client.Active || client.DesktopId != "supervised" ||
+		client.RequestedAccuracyLevel != geoclue2.GClueAccuracyLevelCity || client.DistanceThreshold != 5 {
+		t.Errorf("client after the restart %+v, want the started client with the settings applied again", client)
+	}
+	if path := gsc.Client().ObjectPath(); path != client.Path {
+		t.Errorf("Client() = %s, want %s", path, client.Path)
+	}
+	if l := nextLocation(t, events); l.Latitude != 3 {
+		t.Errorf("latitude after the restart %v, want 3", l.Latitude)
+	}
+
+	if err := gsc.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if clients := srv.Clients(); len(clients) != 0 {
+		t.Errorf("%d clients after Close(), want 0", len(clients))
+	}
+	for range events {
+	}
+}
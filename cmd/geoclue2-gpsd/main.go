@@ -0,0 +1,81 @@
+// Command geoclue2-gpsd serves the location of GeoClue2 over the gpsd JSON protocol, so that gpsd-aware
+// applications work on machines which only run geoclue.
+//
+//	geoclue2-gpsd -listen 127.0.0.1:2947 -desktop-id geoclue2-gpsd -accuracy exact
+//
+// The desktop id must be allowed to use geoclue, see the [<desktop id>] sections of geoclue.conf.
+package main
+
+import (
+	"context"
+	"flag"
+	"github.com/maltegrosse/go-geoclue2"
+	"github.com/maltegrosse/go-geoclue2/gpsd"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+func main() {
+	os.Exit(run())
+}
+
+// run serves the location until it is interrupted and returns the exit code. Errors are returned instead of
+// calling log.Fatal, so the deferred calls release the client.
+func run() int {
+	listen := flag.String("listen", gpsd.DefaultAddress, "TCP address to listen on")
+	desktopId := flag.String("desktop-id", "geoclue2-gpsd", "desktop id used to authorize the client")
+	accuracy := flag.String("accuracy", "exact", "requested accuracy level (country, city, neighborhood, street, exact)")
+	distance := flag.Uint("distance", 0, "distance threshold in meters")
+	interval := flag.Uint("time", 0, "time threshold in seconds")
+	device := flag.String("device", gpsd.DefaultDevice, "device path reported to the clients")
+	flag.Parse()
+
+	level, err := geoclue2.ParseGClueAccuracyLevel(*accuracy)
+	if err != nil {
+		log.Println(err.Error())
+		return 2
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		cancel()
+	}()
+
+	gcm, err := geoclue2.NewGeoclueManager()
+	if err != nil {
+		log.Println(err.Error())
+		return 1
+	}
+	client, err := gcm.Open(ctx, geoclue2.ClientConfig{
+		DesktopId:              *desktopId,
+		RequestedAccuracyLevel: level,
+		DistanceThreshold:      uint32(*distance),
+		TimeThreshold:          uint32(*interval),
+	})
+	if err != nil {
+		log.Println(err.Error())
+		return 1
+	}
+	defer client.Close()
+
+	server := gpsd.NewServer(client)
+	server.Device = *device
+	server.OnError = func(err error) {
+		log.Println(err.Error())
+	}
+	if err := server.Watch(ctx); err != nil {
+		log.Println(err.Error())
+		return 1
+	}
+	if err := server.ListenAndServe(ctx, *listen); err != nil && err != context.Canceled {
+		log.Println(err.Error())
+		return 1
+	}
+	return 0
+}
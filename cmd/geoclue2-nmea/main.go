@@ -0,0 +1,106 @@
+// Command geoclue2-nmea broadcasts the location of GeoClue2 as NMEA 0183 sentences over TCP and advertises
+// the service via Avahi, so geoclue on other machines in the network picks it up as network NMEA source.
+//
+//	geoclue2-nmea -listen :10110 -desktop-id geoclue2-nmea -accuracy exact
+//
+// The desktop id must be allowed to use geoclue, see the [<desktop id>] sections of geoclue.conf.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/maltegrosse/go-geoclue2"
+	"github.com/maltegrosse/go-geoclue2/nmea"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+func main() {
+	os.Exit(run())
+}
+
+// run serves the location until it is interrupted and returns the exit code. Errors are returned instead of
+// calling log.Fatal, so the deferred calls release the client and the Avahi entry group.
+func run() int {
+	listen := flag.String("listen", nmea.DefaultAddress, "TCP address to listen on")
+	desktopId := flag.String("desktop-id", "geoclue2-nmea", "desktop id used to authorize the client")
+	accuracy := flag.String("accuracy", "exact", "requested accuracy level (country, city, neighborhood, street, exact)")
+	distance := flag.Uint("distance", 0, "distance threshold in meters")
+	interval := flag.Uint("time", 0, "time threshold in seconds")
+	name := flag.String("name", "", "advertised service name (default \"GeoClue on <hostname>\")")
+	advertise := flag.Bool("advertise", true, "advertise the service via Avahi")
+	flag.Parse()
+
+	level, err := geoclue2.ParseGClueAccuracyLevel(*accuracy)
+	if err != nil {
+		log.Println(err.Error())
+		return 2
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		cancel()
+	}()
+
+	gcm, err := geoclue2.NewGeoclueManager()
+	if err != nil {
+		log.Println(err.Error())
+		return 1
+	}
+	client, err := gcm.Open(ctx, geoclue2.ClientConfig{
+		DesktopId:              *desktopId,
+		RequestedAccuracyLevel: level,
+		DistanceThreshold:      uint32(*distance),
+		TimeThreshold:          uint32(*interval),
+	})
+	if err != nil {
+		log.Println(err.Error())
+		return 1
+	}
+	defer client.Close()
+
+	server := nmea.NewServer(client)
+	server.OnError = func(err error) {
+		log.Println(err.Error())
+	}
+	if err := server.Watch(ctx); err != nil {
+		log.Println(err.Error())
+		return 1
+	}
+	l, err := net.Listen("tcp", *listen)
+	if err != nil {
+		log.Println(err.Error())
+		return 1
+	}
+	if *advertise {
+		if *name == "" {
+			hostname, err := os.Hostname()
+			if err != nil {
+				log.Println(err.Error())
+				return 1
+			}
+			*name = fmt.Sprintf("GeoClue on %s", hostname)
+		}
+		ad, err := nmea.Advertise(ctx, nil, *name, uint16(l.Addr().(*net.TCPAddr).Port))
+		if err != nil {
+			log.Println(err.Error())
+			return 1
+		}
+		defer func() {
+			_ = ad.Close()
+		}()
+	}
+	if err := server.Serve(ctx, l); err != nil && err != context.Canceled {
+		log.Println(err.Error())
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,366 @@
+// Command geoclue2ctl queries and debugs GeoClue2 from the command line.
+//
+//	geoclue2ctl where   [flags]   print the current location once
+//	geoclue2ctl watch   [flags]   print every location update until interrupted
+//	geoclue2ctl status  [flags]   print the InUse and AvailableAccuracyLevel properties of the manager
+//	geoclue2ctl clients [flags]   list the client objects of geoclue
+//	geoclue2ctl agent   [flags]   run an authorization agent
+//
+// Locations can be printed as text, json, geojson or nmea (-format). The desktop id must be allowed to use
+// geoclue, see the [<desktop id>] sections of geoclue.conf, and the agent id must be listed in [agent].
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/godbus/dbus/v5"
+	"github.com/godbus/dbus/v5/introspect"
+	"github.com/maltegrosse/go-geoclue2"
+	"os"
+	"os/signal"
+	"sort"
+	"syscall"
+	"time"
+)
+
+const usage = `Usage: geoclue2ctl <command> [flags]
+
+Commands:
+  where    print the current location once
+  watch    print every location update until interrupted
+  status   print the state of the manager
+  clients  list the client objects of geoclue
+  agent    run an authorization agent
+
+Run "geoclue2ctl <command> -h" for the flags of a command.
+`
+
+// clientFlags are the flags of the commands creating a client.
+type clientFlags struct {
+	desktopId string
+	accuracy  string
+	distance  uint
+	interval  uint
+	timeout   time.Duration
+	format    string
+}
+
+func (f *clientFlags) register(fs *flag.FlagSet, timeout time.Duration) {
+	fs.StringVar(&f.desktopId, "desktop-id", "geoclue2ctl", "desktop id used to authorize the client")
+	fs.StringVar(&f.accuracy, "accuracy", "exact", "requested accuracy level (country, city, neighborhood, street, exact)")
+	fs.UintVar(&f.distance, "distance", 0, "distance threshold in meters")
+	fs.UintVar(&f.interval, "time", 0, "time threshold in seconds")
+	fs.DurationVar(&f.timeout, "timeout", timeout, "time to wait for a location, 0 to wait forever")
+	fs.StringVar(&f.format, "format", formatText, "output format (text, json, geojson, nmea)")
+}
+
+// parseClientFlags parses the flags of a command creating a client and checks their values.
+func parseClientFlags(fs *flag.FlagSet, args []string, timeout time.Duration) (clientFlags, error) {
+	var f clientFlags
+	f.register(fs, timeout)
+	if err := fs.Parse(args); err != nil {
+		return f, err
+	}
+	if err := checkLocationFormat(f.format); err != nil {
+		return f, err
+	}
+	_, err := f.config()
+	return f, err
+}
+
+// config returns the configuration of the client, it fails for invalid flags.
+func (f clientFlags) config() (geoclue2.ClientConfig, error) {
+	level, err := geoclue2.ParseGClueAccuracyLevel(f.accuracy)
+	if err != nil {
+		return geoclue2.ClientConfig{}, err
+	}
+	cfg := geoclue2.ClientConfig{
+		DesktopId:              f.desktopId,
+		RequestedAccuracyLevel: level,
+		DistanceThreshold:      uint32(f.distance),
+		TimeThreshold:          uint32(f.interval),
+	}
+	return cfg, cfg.Validate()
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		cancel()
+	}()
+
+	var err error
+	command, args := os.Args[1], os.Args[2:]
+	switch command {
+	case "where":
+		err = where(ctx, args)
+	case "watch":
+		err = watch(ctx, args)
+	case "status":
+		err = status(ctx, args)
+	case "clients":
+		err = clients(ctx, args)
+	case "agent":
+		err = agent(ctx, args)
+	case "help", "-h", "-help", "--help":
+		fmt.Fprint(os.Stdout, usage)
+	default:
+		fmt.Fprintf(os.Stderr, "geoclue2ctl: unknown command %q\n\n%s", command, usage)
+		os.Exit(2)
+	}
+	cancel()
+	if err != nil && err != context.Canceled {
+		fmt.Fprintf(os.Stderr, "geoclue2ctl %s: %v\n", command, err)
+		os.Exit(1)
+	}
+}
+
+// startClient opens a client with the given flags and subscribes to its location updates.
+// The returned function stops and deletes the client.
+func startClient(ctx context.Context, gcm geoclue2.GeoclueManager, f clientFlags) (<-chan geoclue2.LocationEvent, func(), error) {
+	cfg, err := f.config()
+	if err != nil {
+		return nil, nil, err
+	}
+	client, err := gcm.Open(ctx, cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	cleanup := func() {
+		_ = client.Close()
+	}
+	events, err := client.Watch(ctx)
+	if err != nil {
+		cleanup()
+		return nil, nil, err
+	}
+	return events, cleanup, nil
+}
+
+func where(ctx context.Context, args []string) error {
+	f, err := parseClientFlags(flag.NewFlagSet("where", flag.ExitOnError), args, 30*time.Second)
+	if err != nil {
+		return err
+	}
+	if f.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, f.timeout)
+		defer cancel()
+	}
+
+	gcm, err := geoclue2.NewGeoclueManager()
+	if err != nil {
+		return err
+	}
+	events, cleanup, err := startClient(ctx, gcm, f)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+	event, ok := <-events
+	if !ok {
+		if ctx.Err() == context.DeadlineExceeded {
+			return geoclue2.ErrTimeout
+		}
+		return ctx.Err()
+	}
+	if event.Err != nil {
+		return event.Err
+	}
+	return printLocation(os.Stdout, f.format, event.New)
+}
+
+func watch(ctx context.Context, args []string) error {
+	f, err := parseClientFlags(flag.NewFlagSet("watch", flag.ExitOnError), args, 0)
+	if err != nil {
+		return err
+	}
+
+	gcm, err := geoclue2.NewGeoclueManager()
+	if err != nil {
+		return err
+	}
+	events, cleanup, err := startClient(ctx, gcm, f)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+	// the timeout applies to every single update
+	var timer *time.Timer
+	var timeout <-chan time.Time
+	if f.timeout > 0 {
+		timer = time.NewTimer(f.timeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				return ctx.Err()
+			}
+			if event.Err != nil {
+				fmt.Fprintf(os.Stderr, "geoclue2ctl watch: %v\n", event.Err)
+				continue
+			}
+			if err := printLocation(os.Stdout, f.format, event.New); err != nil {
+				return err
+			}
+			if timer != nil {
+				if !timer.Stop() {
+					select {
+					case <-timer.C:
+					default:
+					}
+				}
+				timer.Reset(f.timeout)
+			}
+		case <-timeout:
+			return geoclue2.ErrTimeout
+		}
+	}
+}
+
+func status(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("status", flag.ExitOnError)
+	format := fs.String("format", formatText, "output format (text, json)")
+	_ = fs.Parse(args)
+
+	gcm, err := geoclue2.NewGeoclueManager()
+	if err != nil {
+		return err
+	}
+	inUse, err := gcm.InUseWithContext(ctx)
+	if err != nil {
+		return err
+	}
+	level, err := gcm.GetAvailableAccuracyLevelWithContext(ctx)
+	if err != nil {
+		return err
+	}
+	return printFields(os.Stdout, *format, []field{
+		{"InUse", inUse},
+		{"AvailableAccuracyLevel", level},
+	})
+}
+
+func clients(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("clients", flag.ExitOnError)
+	format := fs.String("format", formatText, "output format (text, json)")
+	_ = fs.Parse(args)
+
+	conn, err := dbus.SystemBus()
+	if err != nil {
+		return err
+	}
+	// geoclue exports its clients below this path, but offers no method to list them
+	parent := dbus.ObjectPath(geoclue2.GeoclueObjectPath + "/Client")
+	node, err := introspect.Call(conn.Object(geoclue2.GeoclueInterface, parent))
+	if err != nil {
+		return err
+	}
+	paths := make([]string, 0, len(node.Children))
+	for _, child := range node.Children {
+		paths = append(paths, string(parent)+"/"+child.Name)
+	}
+	sort.Strings(paths)
+	if len(paths) == 0 && *format == formatText {
+		fmt.Println("No clients")
+		return nil
+	}
+
+	rows := make([][]field, 0, len(paths))
+	for _, path := range paths {
+		row := []field{{"Path", path}}
+		client, err := geoclue2.NewGeoclueClient(dbus.ObjectPath(path), geoclue2.WithConn(conn))
+		if err == nil {
+			row, err = clientFields(ctx, client, row)
+		}
+		if err != nil {
+			// geoclue may deny reading clients of other applications
+			row = append(row, field{"Error", err.Error()})
+		}
+		rows = append(rows, row)
+	}
+	return printRows(os.Stdout, *format, rows)
+}
+
+func clientFields(ctx context.Context, client geoclue2.GeoclueClient, row []field) ([]field, error) {
+	desktopId, err := client.GetDesktopIdWithContext(ctx)
+	if err != nil {
+		return row, err
+	}
+	active, err := client.IsActiveWithContext(ctx)
+	if err != nil {
+		return row, err
+	}
+	level, err := client.GetRequestedAccuracyLevelWithContext(ctx)
+	if err != nil {
+		return row, err
+	}
+	distance, err := client.GetDistanceThresholdWithContext(ctx)
+	if err != nil {
+		return row, err
+	}
+	interval, err := client.GetTimeThresholdWithContext(ctx)
+	if err != nil {
+		return row, err
+	}
+	return append(row,
+		field{"DesktopId", desktopId},
+		field{"Active", active},
+		field{"RequestedAccuracyLevel", level},
+		field{"DistanceThreshold", distance},
+		field{"TimeThreshold", interval},
+	), nil
+}
+
+func agent(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("agent", flag.ExitOnError)
+	id := fs.String("id", "geoclue2ctl", "desktop id of the agent, must be listed in the [agent] whitelist of geoclue.conf")
+	policyPath := fs.String("policy", "", "JSON or TOML (*.toml) policy file, reloaded on change (default: allow all)")
+	maxAccuracy := fs.String("max-accuracy", "exact", "maximum accuracy level granted to all applications")
+	_ = fs.Parse(args)
+
+	maxLevel, err := geoclue2.ParseGClueAccuracyLevel(*maxAccuracy)
+	if err != nil {
+		return err
+	}
+	var policy geoclue2.AuthorizationPolicy = geoclue2.AllowAll
+	if *policyPath != "" {
+		file, err := geoclue2.LoadPolicyFile(*policyPath)
+		if err != nil {
+			return err
+		}
+		go file.Watch(ctx, 5*time.Second, func(err error) {
+			fmt.Fprintf(os.Stderr, "geoclue2ctl agent: %v\n", err)
+		})
+		policy = file
+	}
+	logged := geoclue2.AuthorizeAppFunc(func(desktopId string, reqLevel geoclue2.GClueAccuracyLevel) (bool, geoclue2.GClueAccuracyLevel) {
+		authorized, level := policy.AuthorizeApp(desktopId, reqLevel)
+		fmt.Printf("%s %s requested=%v authorized=%v allowed=%v\n",
+			time.Now().Format(time.RFC3339), desktopId, reqLevel, authorized, level)
+		return authorized, level
+	})
+
+	server, err := geoclue2.NewGeoclueAgentServerWithContext(ctx, *id, logged)
+	if err != nil {
+		return err
+	}
+	defer server.Close()
+	if err := server.SetMaxAccuracyLevel(maxLevel); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "geoclue2ctl agent: registered as %q, press Ctrl+C to quit\n", *id)
+	<-ctx.Done()
+	return nil
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"github.com/maltegrosse/go-geoclue2"
+	"io/ioutil"
+	"testing"
+	"time"
+)
+
+func TestParseClientFlags(t *testing.T) {
+	parse := func(args ...string) (clientFlags, error) {
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		fs.SetOutput(ioutil.Discard)
+		return parseClientFlags(fs, args, 30*time.Second)
+	}
+
+	f, err := parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := clientFlags{desktopId: "geoclue2ctl", accuracy: "exact", timeout: 30 * time.Second, format: formatText}
+	if f != want {
+		t.Errorf("defaults %+v, want %+v", f, want)
+	}
+	cfg, err := f.config()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.DesktopId != "geoclue2ctl" || cfg.RequestedAccuracyLevel != geoclue2.GClueAccuracyLevelExact {
+		t.Errorf("config of the defaults %+v", cfg)
+	}
+
+	f, err = parse("-desktop-id", "maps", "-accuracy", "City", "-distance", "100", "-time", "60", "-timeout", "0", "-format", "geojson")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = clientFlags{desktopId: "maps", accuracy: "City", distance: 100, interval: 60, format: formatGeoJSON}
+	if f != want {
+		t.Errorf("flags %+v, want %+v", f, want)
+	}
+	cfg, err = f.config()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.DesktopId != "maps" || cfg.RequestedAccuracyLevel != geoclue2.GClueAccuracyLevelCity ||
+		cfg.DistanceThreshold != 100 || cfg.TimeThreshold != 60 {
+		t.Errorf("config %+v", cfg)
+	}
+
+	for _, args := range [][]string{
+		{"-accuracy", "none"},
+		{"-accuracy", "high"},
+		{"-desktop-id", ""},
+		{"-desktop-id", "maps.desktop"},
+		{"-format", "gpx"},
+		{"-distance", "-1"},
+		{"-timeout", "soon"},
+		{"-unknown"},
+	} {
+		if _, err := parse(args...); err == nil {
+			t.Errorf("%v parsed without error", args)
+		}
+	}
+	if _, err := parse("-accuracy", "none"); !errors.Is(err, geoclue2.ErrInvalidArgs) {
+		t.Errorf("accuracy none: %v, want ErrInvalidArgs", err)
+	}
+}
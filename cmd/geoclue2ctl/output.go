@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/maltegrosse/go-geoclue2"
+	"github.com/maltegrosse/go-geoclue2/nmea"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Output formats
+const (
+	formatText    = "text"
+	formatJSON    = "json"
+	formatGeoJSON = "geojson"
+	formatNMEA    = "nmea"
+)
+
+// field is a named value, printed in order.
+type field struct {
+	name  string
+	value interface{}
+}
+
+func checkLocationFormat(format string) error {
+	switch format {
+	case formatText, formatJSON, formatGeoJSON, formatNMEA:
+		return nil
+	}
+	return fmt.Errorf("unknown format '%s'", format)
+}
+
+func printLocation(w io.Writer, format string, l geoclue2.Location) error {
+	switch format {
+	case formatJSON:
+		b, err := l.MarshalJSON()
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "%s\n", b)
+		return err
+	case formatGeoJSON:
+		b, err := l.MarshalGeoJSON()
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "%s\n", b)
+		return err
+	case formatNMEA:
+		_, err := fmt.Fprint(w, strings.Join(nmea.Sentences(l), "\r\n")+"\r\n")
+		return err
+	case formatText:
+		fields := []field{
+			{"Latitude", l.Latitude},
+			{"Longitude", l.Longitude},
+			{"Accuracy", fmt.Sprintf("%g m", l.Accuracy)},
+		}
+		if l.HasAltitude() {
+			fields = append(fields, field{"Altitude", fmt.Sprintf("%g m", l.Altitude)})
+		}
+		if l.HasSpeed() {
+			fields = append(fields, field{"Speed", fmt.Sprintf("%g m/s", l.Speed)})
+		}
+		if l.HasHeading() {
+			fields = append(fields, field{"Heading", fmt.Sprintf("%g°", l.Heading)})
+		}
+		if l.Description != "" {
+			fields = append(fields, field{"Description", l.Description})
+		}
+		fields = append(fields, field{"Timestamp", l.Timestamp.Format(time.RFC3339Nano)})
+		if err := printFields(w, format, fields); err != nil {
+			return err
+		}
+		_, err := fmt.Fprintln(w)
+		return err
+	}
+	return fmt.Errorf("unknown format '%s'", format)
+}
+
+// printFields prints the fields as aligned "name: value" lines or as JSON object.
+func printFields(w io.Writer, format string, fields []field) error {
+	switch format {
+	case formatJSON:
+		return writeJSON(w, toMap(fields))
+	case formatText:
+		tw := tabwriter.NewWriter(w, 0, 0, 1, ' ', 0)
+		for _, f := range fields {
+			fmt.Fprintf(tw, "%s:\t%v\n", f.name, f.value)
+		}
+		return tw.Flush()
+	}
+	return fmt.Errorf("format '%s' not supported by this command", format)
+}
+
+// printRows prints the rows as blocks of fields or as JSON array.
+func printRows(w io.Writer, format string, rows [][]field) error {
+	if format == formatJSON {
+		objects := make([]map[string]interface{}, 0, len(rows))
+		for _, row := range rows {
+			objects = append(objects, toMap(row))
+		}
+		return writeJSON(w, objects)
+	}
+	for i, row := range rows {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		if err := printFields(w, format, row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func toMap(fields []field) map[string]interface{} {
+	m := make(map[string]interface{}, len(fields))
+	for _, f := range fields {
+		m[f.name] = f.value
+	}
+	return m
+}
+
+func writeJSON(w io.Writer, v interface{}) error {
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s\n", b)
+	return err
+}
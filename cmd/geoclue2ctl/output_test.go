@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/maltegrosse/go-geoclue2"
+	"github.com/maltegrosse/go-geoclue2/nmea"
+	"strings"
+	"testing"
+	"time"
+)
+
+var munich = geoclue2.Location{
+	Latitude:    48.1173,
+	Longitude:   11.5167,
+	Accuracy:    10,
+	Altitude:    545.4,
+	Speed:       geoclue2.UnknownSpeed,
+	Heading:     84.4,
+	Description: "WiFi",
+	Timestamp:   time.Date(2020, 9, 13, 12, 35, 19, 0, time.UTC),
+}
+
+func TestPrintLocation(t *testing.T) {
+	output := func(format string) string {
+		t.Helper()
+		var buf bytes.Buffer
+		if err := printLocation(&buf, format, munich); err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		return buf.String()
+	}
+
+	want := `Latitude:    48.1173
+Longitude:   11.5167
+Accuracy:    10 m
+Altitude:    545.4 m
+Heading:     84.4°
+Description: WiFi
+Timestamp:   2020-09-13T12:35:19Z
+
+`
+	if got := output(formatText); got != want {
+		t.Errorf("text:\n%s\nwant:\n%s", got, want)
+	}
+
+	var location map[string]interface{}
+	if err := json.Unmarshal([]byte(output(formatJSON)), &location); err != nil {
+		t.Fatal(err)
+	}
+	if location["Latitude"] != 48.1173 || location["Speed"] != nil || location["Description"] != "WiFi" {
+		t.Errorf("json: %v", location)
+	}
+
+	var feature geoclue2.GeoJSONFeature
+	if err := json.Unmarshal([]byte(output(formatGeoJSON)), &feature); err != nil {
+		t.Fatal(err)
+	}
+	if feature.Type != geoclue2.GeoJSONTypeFeature || feature.Geometry == nil || feature.Geometry.Type != geoclue2.GeoJSONTypePoint {
+		t.Errorf("geojson: %+v", feature)
+	}
+
+	want = strings.Join(nmea.Sentences(munich), "\r\n") + "\r\n"
+	if got := output(formatNMEA); got != want {
+		t.Errorf("nmea: %q, want %q", got, want)
+	}
+
+	if err := printLocation(&bytes.Buffer{}, "gpx", munich); err == nil {
+		t.Error("unknown format printed without error")
+	}
+	for _, format := range []string{formatText, formatJSON, formatGeoJSON, formatNMEA} {
+		if err := checkLocationFormat(format); err != nil {
+			t.Error(err)
+		}
+	}
+	if err := checkLocationFormat("gpx"); err == nil {
+		t.Error("checkLocationFormat() accepted an unknown format")
+	}
+}
+
+func TestPrintRows(t *testing.T) {
+	rows := [][]field{
+		{{"Path", "/org/freedesktop/GeoClue2/Client/1"}, {"DesktopId", "maps"}, {"Active", true}},
+		{{"Path", "/org/freedesktop/GeoClue2/Client/2"}, {"Error", "access denied"}},
+	}
+	var buf bytes.Buffer
+	if err := printRows(&buf, formatText, rows); err != nil {
+		t.Fatal(err)
+	}
+	want := `Path:      /org/freedesktop/GeoClue2/Client/1
+DesktopId: maps
+Active:    true
+
+Path:  /org/freedesktop/GeoClue2/Client/2
+Error: access denied
+`
+	if buf.String() != want {
+		t.Errorf("text:\n%s\nwant:\n%s", buf.String(), want)
+	}
+
+	buf.Reset()
+	if err := printRows(&buf, formatJSON, rows); err != nil {
+		t.Fatal(err)
+	}
+	var objects []map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &objects); err != nil {
+		t.Fatal(err)
+	}
+	if len(objects) != 2 || objects[0]["DesktopId"] != "maps" || objects[0]["Active"] != true || objects[1]["Error"] != "access denied" {
+		t.Errorf("json: %v", objects)
+	}
+
+	// the status command prints its fields in the same formats, but does not support location formats
+	buf.Reset()
+	if err := printFields(&buf, formatJSON, []field{{"InUse", false}, {"AvailableAccuracyLevel", geoclue2.GClueAccuracyLevelCity}}); err != nil {
+		t.Fatal(err)
+	}
+	var status map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &status); err != nil {
+		t.Fatal(err)
+	}
+	if status["InUse"] != false || status["AvailableAccuracyLevel"] != float64(geoclue2.GClueAccuracyLevelCity) {
+		t.Errorf("status json: %v", status)
+	}
+	if err := printFields(&buf, formatNMEA, nil); err == nil {
+		t.Error("printFields() accepted a location format")
+	}
+}
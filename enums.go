@@ -1,5 +1,11 @@
 package geoclue2
 
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
 // GClueAccuracyLevel is used to specify level of accuracy requested by, or allowed for a client.
 type GClueAccuracyLevel uint32
 
@@ -13,3 +19,30 @@ const (
 	GClueAccuracyLevelExact        GClueAccuracyLevel = 8 //Exact accuracy. Typically requires GPS receiver.
 
 )
+
+var gclueAccuracyLevels = []GClueAccuracyLevel{
+	GClueAccuracyLevelNone,
+	GClueAccuracyLevelCountry,
+	GClueAccuracyLevelCity,
+	GClueAccuracyLevelNeighborhood,
+	GClueAccuracyLevelStreet,
+	GClueAccuracyLevelExact,
+}
+
+// ParseGClueAccuracyLevel parses an accuracy level given by its name (case-insensitive, e.g. "city") or its numeric value.
+func ParseGClueAccuracyLevel(s string) (GClueAccuracyLevel, error) {
+	for _, level := range gclueAccuracyLevels {
+		if strings.EqualFold(s, level.String()) {
+			return level, nil
+		}
+	}
+	n, err := strconv.ParseUint(s, 10, 32)
+	if err == nil {
+		for _, level := range gclueAccuracyLevels {
+			if GClueAccuracyLevel(n) == level {
+				return level, nil
+			}
+		}
+	}
+	return GClueAccuracyLevelNone, fmt.Errorf("invalid accuracy level '%s'", s)
+}
@@ -0,0 +1,137 @@
+package geoclue2
+
+import (
+	"errors"
+	"github.com/godbus/dbus/v5"
+	"strconv"
+	"strings"
+)
+
+// Sentinel errors returned by the GeoClue2 objects. Errors received from D-Bus are returned as *Error,
+// which wraps the matching sentinel error, so callers can use errors.Is(err, geoclue2.ErrAccessDenied).
+var (
+	// The application is not allowed to do this, e.g. the agent or the geoclue configuration denied access.
+	ErrAccessDenied = errors.New("access denied")
+	// GeoClue2 is not installed or could not be activated on the bus.
+	ErrServiceUnknown = errors.New("service unknown")
+	// The service did not reply to a method call.
+	ErrNoReply = errors.New("no reply")
+	// The request timed out.
+	ErrTimeout = errors.New("timed out")
+	// The object does not exist (anymore), e.g. after the geoclue daemon restarted.
+	ErrUnknownObject = errors.New("unknown object")
+	// The method, interface or property does not exist on the object.
+	ErrUnknownMethod = errors.New("unknown method")
+	// Invalid arguments were passed to a method or property.
+	ErrInvalidArgs = errors.New("invalid arguments")
+	// The requested item could not be found.
+	ErrNotFound = errors.New("not found")
+	// The operation is not supported.
+	ErrNotSupported = errors.New("not supported")
+	// The operation failed for an unspecified reason.
+	ErrFailed = errors.New("failed")
+	// The client must be started before gathering the location.
+	ErrNotActive = errors.New("client must be started before gathering the location")
+)
+
+// D-Bus error names
+const (
+	DBusErrorAccessDenied     = "org.freedesktop.DBus.Error.AccessDenied"
+	DBusErrorServiceUnknown   = "org.freedesktop.DBus.Error.ServiceUnknown"
+	DBusErrorNameHasNoOwner   = "org.freedesktop.DBus.Error.NameHasNoOwner"
+	DBusErrorNoReply          = "org.freedesktop.DBus.Error.NoReply"
+	DBusErrorTimeout          = "org.freedesktop.DBus.Error.Timeout"
+	DBusErrorTimedOut         = "org.freedesktop.DBus.Error.TimedOut"
+	DBusErrorUnknownObject    = "org.freedesktop.DBus.Error.UnknownObject"
+	DBusErrorUnknownMethod    = "org.freedesktop.DBus.Error.UnknownMethod"
+	DBusErrorUnknownInterface = "org.freedesktop.DBus.Error.UnknownInterface"
+	DBusErrorUnknownProperty  = "org.freedesktop.DBus.Error.UnknownProperty"
+	DBusErrorInvalidArgs      = "org.freedesktop.DBus.Error.InvalidArgs"
+	DBusErrorNotSupported     = "org.freedesktop.DBus.Error.NotSupported"
+	DBusErrorFailed           = "org.freedesktop.DBus.Error.Failed"
+
+	// GeoClue2 reports its own (GIO) errors with the GDBus naming scheme for unmapped errors,
+	// followed by the GIOErrorEnum code.
+	GeoclueErrorPrefix = "org.gtk.GDBus.UnmappedGError.Quark._g_2dio_2derror_2dquark.Code"
+)
+
+var dbusErrors = map[string]error{
+	DBusErrorAccessDenied:     ErrAccessDenied,
+	DBusErrorServiceUnknown:   ErrServiceUnknown,
+	DBusErrorNameHasNoOwner:   ErrServiceUnknown,
+	DBusErrorNoReply:          ErrNoReply,
+	DBusErrorTimeout:          ErrTimeout,
+	DBusErrorTimedOut:         ErrTimeout,
+	DBusErrorUnknownObject:    ErrUnknownObject,
+	DBusErrorUnknownMethod:    ErrUnknownMethod,
+	DBusErrorUnknownInterface: ErrUnknownMethod,
+	DBusErrorUnknownProperty:  ErrUnknownMethod,
+	DBusErrorInvalidArgs:      ErrInvalidArgs,
+	DBusErrorNotSupported:     ErrNotSupported,
+	DBusErrorFailed:           ErrFailed,
+}
+
+// GIOErrorEnum codes used by GeoClue2
+var geoclueErrors = map[int]error{
+	0:  ErrFailed,       // G_IO_ERROR_FAILED
+	1:  ErrNotFound,     // G_IO_ERROR_NOT_FOUND
+	13: ErrInvalidArgs,  // G_IO_ERROR_INVALID_ARGUMENT
+	14: ErrAccessDenied, // G_IO_ERROR_PERMISSION_DENIED
+	15: ErrNotSupported, // G_IO_ERROR_NOT_SUPPORTED
+	24: ErrTimeout,      // G_IO_ERROR_TIMED_OUT
+}
+
+// Error is an error returned by GeoClue2 or the D-Bus daemon.
+type Error struct {
+	// The D-Bus error name, e.g. org.freedesktop.DBus.Error.AccessDenied
+	Name string
+	// The error message sent along with the error, if any.
+	Message string
+
+	err error
+}
+
+func (e *Error) Error() string {
+	if e.Message == "" {
+		return e.Name
+	}
+	return e.Name + ": " + e.Message
+}
+
+// Unwrap returns the sentinel error matching the D-Bus error name, or nil if the name is unknown.
+func (e *Error) Unwrap() error {
+	return e.err
+}
+
+// lookupError returns the sentinel error for the given D-Bus error name.
+func lookupError(name string) error {
+	if err, ok := dbusErrors[name]; ok {
+		return err
+	}
+	if strings.HasPrefix(name, GeoclueErrorPrefix) {
+		code, err := strconv.Atoi(strings.TrimPrefix(name, GeoclueErrorPrefix))
+		if err == nil {
+			return geoclueErrors[code]
+		}
+	}
+	return nil
+}
+
+// makeError converts a D-Bus error into an *Error, all other errors are returned unchanged.
+func makeError(err error) error {
+	var name string
+	var body []interface{}
+	switch e := err.(type) {
+	case dbus.Error:
+		name, body = e.Name, e.Body
+	case *dbus.Error:
+		name, body = e.Name, e.Body
+	default:
+		return err
+	}
+	gErr := &Error{Name: name, err: lookupError(name)}
+	if len(body) > 0 {
+		gErr.Message, _ = body[0].(string)
+	}
+	return gErr
+}
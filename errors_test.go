@@ -0,0 +1,71 @@
+package geoclue2
+
+import (
+	"errors"
+	"fmt"
+	"github.com/godbus/dbus/v5"
+	"testing"
+)
+
+func TestMakeError(t *testing.T) {
+	tests := []struct {
+		err     error
+		want    error
+		message string
+	}{
+		{dbus.Error{Name: DBusErrorAccessDenied, Body: []interface{}{"denied by agent"}}, ErrAccessDenied, "denied by agent"},
+		{&dbus.Error{Name: DBusErrorAccessDenied}, ErrAccessDenied, ""},
+		{dbus.Error{Name: DBusErrorServiceUnknown}, ErrServiceUnknown, ""},
+		{dbus.Error{Name: DBusErrorNameHasNoOwner}, ErrServiceUnknown, ""},
+		{dbus.Error{Name: DBusErrorNoReply}, ErrNoReply, ""},
+		{dbus.Error{Name: DBusErrorTimeout}, ErrTimeout, ""},
+		{dbus.Error{Name: DBusErrorTimedOut}, ErrTimeout, ""},
+		{dbus.Error{Name: DBusErrorUnknownObject}, ErrUnknownObject, ""},
+		{dbus.Error{Name: DBusErrorUnknownMethod}, ErrUnknownMethod, ""},
+		{dbus.Error{Name: DBusErrorUnknownInterface}, ErrUnknownMethod, ""},
+		{dbus.Error{Name: DBusErrorUnknownProperty}, ErrUnknownMethod, ""},
+		{dbus.Error{Name: DBusErrorInvalidArgs, Body: []interface{}{1}}, ErrInvalidArgs, ""},
+		{dbus.Error{Name: DBusErrorNotSupported}, ErrNotSupported, ""},
+		{dbus.Error{Name: DBusErrorFailed}, ErrFailed, ""},
+		{dbus.Error{Name: GeoclueErrorPrefix + "0"}, ErrFailed, ""},
+		{dbus.Error{Name: GeoclueErrorPrefix + "1"}, ErrNotFound, ""},
+		{dbus.Error{Name: GeoclueErrorPrefix + "13"}, ErrInvalidArgs, ""},
+		{dbus.Error{Name: GeoclueErrorPrefix + "14", Body: []interface{}{"Geolocation disabled"}}, ErrAccessDenied, "Geolocation disabled"},
+		{dbus.Error{Name: GeoclueErrorPrefix + "15"}, ErrNotSupported, ""},
+		{dbus.Error{Name: GeoclueErrorPrefix + "24"}, ErrTimeout, ""},
+		// unknown names and codes are returned as *Error without a sentinel error
+		{dbus.Error{Name: GeoclueErrorPrefix + "2"}, nil, ""},
+		{dbus.Error{Name: GeoclueErrorPrefix + "x"}, nil, ""},
+		{dbus.Error{Name: "org.example.Error"}, nil, ""},
+	}
+	for _, test := range tests {
+		err := makeError(test.err)
+		var gErr *Error
+		if !errors.As(err, &gErr) {
+			t.Errorf("makeError(%v) = %T, want *Error", test.err, err)
+			continue
+		}
+		if gErr.Message != test.message {
+			t.Errorf("makeError(%v).Message = %q, want %q", test.err, gErr.Message, test.message)
+		}
+		if test.want == nil {
+			if gErr.Unwrap() != nil {
+				t.Errorf("makeError(%v) wraps %v, want nil", test.err, gErr.Unwrap())
+			}
+			continue
+		}
+		if !errors.Is(err, test.want) {
+			t.Errorf("makeError(%v) = %v, want errors.Is(err, %v)", test.err, err, test.want)
+		}
+		// the sentinel error is still found if the error is wrapped again
+		if wrapped := fmt.Errorf("call failed: %w", err); !errors.Is(wrapped, test.want) {
+			t.Errorf("%v does not match %v", wrapped, test.want)
+		}
+	}
+
+	// other errors are returned unchanged
+	other := errors.New("connection closed")
+	if err := makeError(other); err != other {
+		t.Errorf("makeError(%v) = %v, want the error unchanged", other, err)
+	}
+}
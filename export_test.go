@@ -0,0 +1,29 @@
+package geoclue2
+
+import (
+	"github.com/godbus/dbus/v5"
+)
+
+// DispatcherState returns a copy of the match rule reference counts and of the tracked name owners of the
+// signal dispatcher of conn, so the external tests can check that closed subscriptions clean up after themselves.
+func DispatcherState(conn *dbus.Conn) (rules map[string]int, owners map[string]string) {
+	rules = make(map[string]int)
+	owners = make(map[string]string)
+	dispatchersMu.Lock()
+	d, ok := dispatchers[conn]
+	dispatchersMu.Unlock()
+	if !ok {
+		return
+	}
+	d.rulesMu.Lock()
+	for rule, refs := range d.rules {
+		rules[rule] = refs
+	}
+	d.rulesMu.Unlock()
+	d.mu.Lock()
+	for name, owner := range d.owners {
+		owners[name] = owner
+	}
+	d.mu.Unlock()
+	return
+}
@@ -0,0 +1,92 @@
+package geoclue2_test
+
+import (
+	"context"
+	"errors"
+	"github.com/godbus/dbus/v5"
+	"github.com/maltegrosse/go-geoclue2"
+	"github.com/maltegrosse/go-geoclue2/geoclue2test"
+	"os/exec"
+	"testing"
+	"time"
+)
+
+// timeout limits the waiting for signals and events in the tests.
+const timeout = 5 * time.Second
+
+// fake is a private bus with the fake GeoClue2 service.
+type fake struct {
+	bus   *geoclue2test.Bus
+	srv   *geoclue2test.Service
+	conns []*dbus.Conn
+}
+
+// newFake starts the fake service, the test is skipped if dbus-daemon is not installed.
+func newFake(t *testing.T) *fake {
+	t.Helper()
+	bus, err := geoclue2test.NewBus()
+	if errors.Is(err, exec.ErrNotFound) {
+		t.Skip("dbus-daemon not found")
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &fake{bus: bus}
+	f.srv, err = geoclue2test.NewService(f.dial(t))
+	if err != nil {
+		f.close()
+		t.Fatal(err)
+	}
+	return f
+}
+
+// dial opens a connection of a new peer, which is closed by close().
+func (f *fake) dial(t *testing.T) *dbus.Conn {
+	t.Helper()
+	conn, err := f.bus.Dial()
+	if err != nil {
+		f.close()
+		t.Fatal(err)
+	}
+	f.conns = append(f.conns, conn)
+	return conn
+}
+
+// manager returns a manager on a connection of a new peer.
+func (f *fake) manager(t *testing.T) geoclue2.GeoclueManager {
+	t.Helper()
+	gcm, err := geoclue2.NewGeoclueManager(geoclue2.WithConn(f.dial(t)))
+	if err != nil {
+		f.close()
+		t.Fatal(err)
+	}
+	return gcm
+}
+
+func (f *fake) close() {
+	for _, conn := range f.conns {
+		conn.Close()
+	}
+	f.bus.Close()
+}
+
+// newClient creates a client with the given desktop id, requesting the exact accuracy level.
+func newClient(t *testing.T, gcm geoclue2.GeoclueManager, desktopId string) geoclue2.GeoclueClient {
+	t.Helper()
+	gcc, err := gcm.CreateClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := gcc.SetDesktopId(desktopId); err != nil {
+		t.Fatal(err)
+	}
+	if err := gcc.SetRequestedAccuracyLevel(geoclue2.GClueAccuracyLevelExact); err != nil {
+		t.Fatal(err)
+	}
+	return gcc
+}
+
+// contextWithTimeout returns a context, which is done after timeout.
+func contextWithTimeout() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), timeout)
+}
@@ -0,0 +1,168 @@
+package geoclue2test
+
+import (
+	"fmt"
+	"github.com/godbus/dbus/v5"
+	"github.com/godbus/dbus/v5/prop"
+	"github.com/maltegrosse/go-geoclue2"
+	"time"
+)
+
+type client struct {
+	s       *Service
+	path    dbus.ObjectPath
+	owner   string
+	props   *prop.Properties
+	allowed geoclue2.GClueAccuracyLevel
+
+	nextLocation uint
+	current      *location
+	previous     *location
+	last         *Location
+}
+
+func exportClient(s *Service, path dbus.ObjectPath, owner string) (*client, error) {
+	c := &client{s: s, path: path, owner: owner}
+	var err error
+	c.props, err = prop.Export(s.conn, path, map[string]map[string]*prop.Prop{
+		geoclue2.GeoclueClientInterface: {
+			"Location":               {Value: dbus.ObjectPath("/"), Emit: prop.EmitTrue},
+			"DistanceThreshold":      {Value: uint32(0), Writable: true, Emit: prop.EmitTrue},
+			"TimeThreshold":          {Value: uint32(0), Writable: true, Emit: prop.EmitTrue},
+			"DesktopId":              {Value: "", Writable: true, Emit: prop.EmitTrue},
+			"RequestedAccuracyLevel": {Value: uint32(0), Writable: true, Emit: prop.EmitTrue},
+			"Active":                 {Value: false, Emit: prop.EmitTrue},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = s.conn.ExportMethodTable(map[string]interface{}{
+		"Start": c.start,
+		"Stop":  c.stop,
+	}, path, geoclue2.GeoclueClientInterface)
+	if err != nil {
+		s.conn.Export(nil, path, propertiesInterface)
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *client) unexport() {
+	if c.current != nil {
+		c.current.unexport()
+	}
+	if c.previous != nil {
+		c.previous.unexport()
+	}
+	c.s.conn.Export(nil, c.path, geoclue2.GeoclueClientInterface)
+	c.s.conn.Export(nil, c.path, propertiesInterface)
+}
+
+func (c *client) get(name string) interface{} {
+	return c.props.GetMust(geoclue2.GeoclueClientInterface, name)
+}
+
+func (c *client) active() bool {
+	return c.get("Active").(bool)
+}
+
+func (c *client) desktopId() string {
+	return c.get("DesktopId").(string)
+}
+
+func (c *client) setActive(active bool) {
+	c.props.SetMust(geoclue2.GeoclueClientInterface, "Active", active)
+}
+
+func (c *client) state() ClientState {
+	return ClientState{
+		Path:                   c.path,
+		Owner:                  c.owner,
+		DesktopId:              c.desktopId(),
+		RequestedAccuracyLevel: geoclue2.GClueAccuracyLevel(c.get("RequestedAccuracyLevel").(uint32)),
+		AllowedAccuracyLevel:   c.allowed,
+		DistanceThreshold:      c.get("DistanceThreshold").(uint32),
+		TimeThreshold:          c.get("TimeThreshold").(uint32),
+		Active:                 c.active(),
+		Location:               c.get("Location").(dbus.ObjectPath),
+	}
+}
+
+func (c *client) checkOwner(sender dbus.Sender) *dbus.Error {
+	if string(sender) != c.owner {
+		return makeError(geoclue2.DBusErrorAccessDenied, "Client '%s' not owned by caller", c.path)
+	}
+	return nil
+}
+
+func (c *client) start(sender dbus.Sender) *dbus.Error {
+	c.s.mu.Lock()
+	defer c.s.mu.Unlock()
+	if err := c.checkOwner(sender); err != nil {
+		return err
+	}
+	if c.active() {
+		return nil
+	}
+	reqLevel := geoclue2.GClueAccuracyLevel(c.get("RequestedAccuracyLevel").(uint32))
+	allowed, err := c.s.authorizeClient(c.desktopId(), reqLevel)
+	if err != nil {
+		return err
+	}
+	c.allowed = allowed
+	c.setActive(true)
+	c.s.updateInUse()
+	if c.s.location != nil {
+		c.deliver(*c.s.location, true)
+	}
+	return nil
+}
+
+func (c *client) stop(sender dbus.Sender) *dbus.Error {
+	c.s.mu.Lock()
+	defer c.s.mu.Unlock()
+	if err := c.checkOwner(sender); err != nil {
+		return err
+	}
+	if c.active() {
+		c.setActive(false)
+		c.s.updateInUse()
+	}
+	return nil
+}
+
+// deliver exports a new Location object for loc and emits LocationUpdated, unless the location is
+// within the distance and time thresholds of the last delivered one and force is false.
+func (c *client) deliver(loc Location, force bool) {
+	if c.last != nil && !force {
+		distanceThreshold := c.get("DistanceThreshold").(uint32)
+		timeThreshold := c.get("TimeThreshold").(uint32)
+		if distanceThreshold > 0 && distance(*c.last, loc) < float64(distanceThreshold) {
+			return
+		}
+		if timeThreshold > 0 && loc.Timestamp.Sub(c.last.Timestamp) < time.Duration(timeThreshold)*time.Second {
+			return
+		}
+	}
+
+	path := dbus.ObjectPath(fmt.Sprintf("%s/Location/%d", c.path, c.nextLocation))
+	c.nextLocation++
+	l, err := exportLocation(c.s.conn, path, loc)
+	if err != nil {
+		return
+	}
+	oldPath := dbus.ObjectPath("/")
+	if c.current != nil {
+		oldPath = c.current.path
+	}
+	// geoclue keeps the old location object around, so clients can still read it on LocationUpdated
+	if c.previous != nil {
+		c.previous.unexport()
+	}
+	c.previous = c.current
+	c.current = l
+	c.last = &loc
+	c.props.SetMust(geoclue2.GeoclueClientInterface, "Location", path)
+	c.s.conn.Emit(c.path, geoclue2.GeoclueClientInterface+"."+geoclue2.GeoclueClientSignalLocationUpdated, oldPath, path)
+}
@@ -0,0 +1,78 @@
+package geoclue2test
+
+import (
+	"github.com/godbus/dbus/v5"
+	"github.com/godbus/dbus/v5/prop"
+	"github.com/maltegrosse/go-geoclue2"
+	"time"
+)
+
+// Values used by geoclue for unknown location fields
+const (
+	UnknownAltitude = geoclue2.UnknownAltitude
+	UnknownSpeed    = geoclue2.UnknownSpeed
+	UnknownHeading  = geoclue2.UnknownHeading
+)
+
+// Location is a location served by the fake service.
+type Location struct {
+	Latitude    float64
+	Longitude   float64
+	Accuracy    float64
+	Altitude    float64
+	Speed       float64
+	Heading     float64
+	Description string
+	Timestamp   time.Time
+}
+
+// NewLocation returns a location with unknown altitude, speed and heading, taken now.
+func NewLocation(latitude, longitude, accuracy float64) Location {
+	return Location{
+		Latitude:  latitude,
+		Longitude: longitude,
+		Accuracy:  accuracy,
+		Altitude:  UnknownAltitude,
+		Speed:     UnknownSpeed,
+		Heading:   UnknownHeading,
+		Timestamp: time.Now(),
+	}
+}
+
+// timestamp is the (tt) representation of the Timestamp property: seconds and microseconds since the Epoch.
+type timestamp struct {
+	Seconds      uint64
+	Microseconds uint64
+}
+
+type location struct {
+	conn *dbus.Conn
+	path dbus.ObjectPath
+}
+
+func exportLocation(conn *dbus.Conn, path dbus.ObjectPath, loc Location) (*location, error) {
+	ts := timestamp{
+		Seconds:      uint64(loc.Timestamp.Unix()),
+		Microseconds: uint64(loc.Timestamp.Nanosecond() / 1000),
+	}
+	_, err := prop.Export(conn, path, map[string]map[string]*prop.Prop{
+		geoclue2.GeoclueLocationInterface: {
+			"Latitude":    {Value: loc.Latitude},
+			"Longitude":   {Value: loc.Longitude},
+			"Accuracy":    {Value: loc.Accuracy},
+			"Altitude":    {Value: loc.Altitude},
+			"Speed":       {Value: loc.Speed},
+			"Heading":     {Value: loc.Heading},
+			"Description": {Value: loc.Description},
+			"Timestamp":   {Value: ts},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &location{conn: conn, path: path}, nil
+}
+
+func (l *location) unexport() {
+	l.conn.Export(nil, l.path, propertiesInterface)
+}
@@ -0,0 +1,420 @@
+package geoclue2test
+
+import (
+	"fmt"
+	"github.com/godbus/dbus/v5"
+	"github.com/godbus/dbus/v5/prop"
+	"github.com/maltegrosse/go-geoclue2"
+	"math"
+	"sort"
+	"sync"
+)
+
+const (
+	dbusInterface        = "org.freedesktop.DBus"
+	dbusNameOwnerChanged = "NameOwnerChanged"
+	propertiesInterface  = "org.freedesktop.DBus.Properties"
+)
+
+// AuthorizeFunc decides whether the application with the given desktop id may start a client with the
+// requested accuracy level, and which accuracy level it is allowed to use.
+type AuthorizeFunc func(desktopId string, reqLevel geoclue2.GClueAccuracyLevel) (authorized bool, allowedLevel geoclue2.GClueAccuracyLevel)
+
+// ClientState is a snapshot of the properties of a client object exported by the fake service.
+type ClientState struct {
+	Path                   dbus.ObjectPath
+	Owner                  string
+	DesktopId              string
+	RequestedAccuracyLevel geoclue2.GClueAccuracyLevel
+	AllowedAccuracyLevel   geoclue2.GClueAccuracyLevel
+	DistanceThreshold      uint32
+	TimeThreshold          uint32
+	Active                 bool
+	Location               dbus.ObjectPath
+}
+
+// Service is a fake org.freedesktop.GeoClue2 service. It exports the Manager, a Client object per GetClient()
+// peer or CreateClient() call and a Location object for every location delivered to an active client,
+// and emits the LocationUpdated signals like geoclue does.
+type Service struct {
+	conn *dbus.Conn
+
+	mu          sync.Mutex
+	props       *prop.Properties
+	clients     map[dbus.ObjectPath]*client
+	peers       map[string]dbus.ObjectPath
+	nextClient  uint
+	location    *Location
+	available   geoclue2.GClueAccuracyLevel
+	authorize   AuthorizeFunc
+	denied      map[string]bool
+	agents      map[string]string
+	sigChan     chan *dbus.Signal
+	closed      bool
+	closeSignal chan struct{}
+}
+
+// NewService exports a new fake service on conn and requests the org.freedesktop.GeoClue2 name.
+// The service allows all applications with a desktop id and an available accuracy level of
+// GClueAccuracyLevelExact, until configured otherwise.
+func NewService(conn *dbus.Conn) (*Service, error) {
+	s := &Service{
+		conn:        conn,
+		clients:     make(map[dbus.ObjectPath]*client),
+		peers:       make(map[string]dbus.ObjectPath),
+		nextClient:  1,
+		available:   geoclue2.GClueAccuracyLevelExact,
+		denied:      make(map[string]bool),
+		agents:      make(map[string]string),
+		closeSignal: make(chan struct{}),
+	}
+
+	var err error
+	s.props, err = prop.Export(conn, geoclue2.GeoclueManagerObjectPath, map[string]map[string]*prop.Prop{
+		geoclue2.GeoclueManagerInterface: {
+			"InUse":                  {Value: false, Emit: prop.EmitTrue},
+			"AvailableAccuracyLevel": {Value: uint32(s.available), Emit: prop.EmitTrue},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = conn.ExportMethodTable(map[string]interface{}{
+		"GetClient":    s.getClient,
+		"CreateClient": s.createClient,
+		"DeleteClient": s.deleteClient,
+		"AddAgent":     s.addAgent,
+	}, geoclue2.GeoclueManagerObjectPath, geoclue2.GeoclueManagerInterface)
+	if err != nil {
+		return nil, err
+	}
+
+	// clients of disconnected peers are removed, like geoclue does
+	err = conn.AddMatchSignal(dbus.WithMatchSender(dbusInterface), dbus.WithMatchInterface(dbusInterface),
+		dbus.WithMatchMember(dbusNameOwnerChanged))
+	if err != nil {
+		return nil, err
+	}
+	s.sigChan = make(chan *dbus.Signal, 10)
+	conn.Signal(s.sigChan)
+	go s.watchPeers()
+
+	reply, err := conn.RequestName(geoclue2.GeoclueInterface, dbus.NameFlagDoNotQueue)
+	if err != nil {
+		s.Close()
+		return nil, err
+	}
+	if reply != dbus.RequestNameReplyPrimaryOwner {
+		s.Close()
+		return nil, fmt.Errorf("name %s already taken", geoclue2.GeoclueInterface)
+	}
+	return s, nil
+}
+
+// Close removes all exported objects and releases the service name. The connection is not closed.
+func (s *Service) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	close(s.closeSignal)
+	s.conn.RemoveSignal(s.sigChan)
+	for _, c := range s.clients {
+		c.unexport()
+	}
+	s.clients = make(map[dbus.ObjectPath]*client)
+	s.peers = make(map[string]dbus.ObjectPath)
+	s.conn.Export(nil, geoclue2.GeoclueManagerObjectPath, geoclue2.GeoclueManagerInterface)
+	s.conn.Export(nil, geoclue2.GeoclueManagerObjectPath, propertiesInterface)
+	_, err := s.conn.ReleaseName(geoclue2.GeoclueInterface)
+	return err
+}
+
+// SetLocation sets the current location of the service and delivers it to all active clients,
+// honoring their distance and time thresholds.
+func (s *Service) SetLocation(loc Location) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.location = &loc
+	for _, c := range s.sortedClients() {
+		if c.active() {
+			c.deliver(loc, false)
+		}
+	}
+}
+
+// SetAvailableAccuracyLevel sets the AvailableAccuracyLevel of the manager. Clients started afterwards are
+// limited to this level.
+func (s *Service) SetAvailableAccuracyLevel(level geoclue2.GClueAccuracyLevel) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.available = level
+	s.props.SetMust(geoclue2.GeoclueManagerInterface, "AvailableAccuracyLevel", uint32(level))
+}
+
+// SetAuthorizer installs a function, which is consulted whenever a client is started. A nil function
+// allows all applications. If an agent registered itself with AddAgent, its AuthorizeApp method is
+// called as well, like geoclue does.
+func (s *Service) SetAuthorizer(f AuthorizeFunc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.authorize = f
+}
+
+// Deny denies the access for the given desktop id. Already running clients of the application are stopped,
+// like geoclue does on agent request.
+func (s *Service) Deny(desktopId string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.denied[desktopId] = true
+	for _, c := range s.sortedClients() {
+		if c.active() && c.desktopId() == desktopId {
+			c.setActive(false)
+		}
+	}
+	s.updateInUse()
+}
+
+// Allow removes a denial previously added with Deny.
+func (s *Service) Allow(desktopId string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.denied, desktopId)
+}
+
+// Clients returns the state of all client objects, sorted by object path.
+func (s *Service) Clients() []ClientState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var states []ClientState
+	for _, c := range s.sortedClients() {
+		states = append(states, c.state())
+	}
+	return states
+}
+
+// Client returns the state of the client object with the given path.
+func (s *Service) Client(path dbus.ObjectPath) (ClientState, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := s.clients[path]
+	if !ok {
+		return ClientState{}, false
+	}
+	return c.state(), true
+}
+
+// Agents returns the desktop ids of the agents registered with AddAgent, by the unique name of their peer.
+func (s *Service) Agents() map[string]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	agents := make(map[string]string, len(s.agents))
+	for k, v := range s.agents {
+		agents[k] = v
+	}
+	return agents
+}
+
+func (s *Service) sortedClients() []*client {
+	clients := make([]*client, 0, len(s.clients))
+	for _, c := range s.clients {
+		clients = append(clients, c)
+	}
+	sort.Slice(clients, func(i, j int) bool { return clients[i].path < clients[j].path })
+	return clients
+}
+
+func (s *Service) updateInUse() {
+	inUse := false
+	for _, c := range s.clients {
+		if c.active() {
+			inUse = true
+			break
+		}
+	}
+	if s.props.GetMust(geoclue2.GeoclueManagerInterface, "InUse").(bool) != inUse {
+		s.props.SetMust(geoclue2.GeoclueManagerInterface, "InUse", inUse)
+	}
+}
+
+func (s *Service) newClient(owner string) (*client, *dbus.Error) {
+	path := dbus.ObjectPath(fmt.Sprintf("%s/%d", geoclue2.GeoclueClientObjectPath, s.nextClient))
+	s.nextClient++
+	c, err := exportClient(s, path, owner)
+	if err != nil {
+		return nil, dbus.MakeFailedError(err)
+	}
+	s.clients[path] = c
+	return c, nil
+}
+
+func (s *Service) removeClient(c *client) {
+	wasActive := c.active()
+	c.unexport()
+	delete(s.clients, c.path)
+	if s.peers[c.owner] == c.path {
+		delete(s.peers, c.owner)
+	}
+	if wasActive {
+		s.updateInUse()
+	}
+}
+
+func (s *Service) getClient(sender dbus.Sender) (dbus.ObjectPath, *dbus.Error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if path, ok := s.peers[string(sender)]; ok {
+		return path, nil
+	}
+	c, err := s.newClient(string(sender))
+	if err != nil {
+		return "", err
+	}
+	s.peers[string(sender)] = c.path
+	return c.path, nil
+}
+
+func (s *Service) createClient(sender dbus.Sender) (dbus.ObjectPath, *dbus.Error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, err := s.newClient(string(sender))
+	if err != nil {
+		return "", err
+	}
+	return c.path, nil
+}
+
+func (s *Service) deleteClient(sender dbus.Sender, path dbus.ObjectPath) *dbus.Error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := s.clients[path]
+	if !ok {
+		return makeError(geoclue2.DBusErrorInvalidArgs, "Client '%s' not found", path)
+	}
+	if c.owner != string(sender) {
+		return makeError(geoclue2.DBusErrorAccessDenied, "Client '%s' not owned by caller", path)
+	}
+	s.removeClient(c)
+	return nil
+}
+
+func (s *Service) addAgent(sender dbus.Sender, id string) *dbus.Error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.agents[string(sender)] = id
+	return nil
+}
+
+// authorizeClient returns the accuracy level allowed for the client or an AccessDenied error.
+func (s *Service) authorizeClient(desktopId string, reqLevel geoclue2.GClueAccuracyLevel) (geoclue2.GClueAccuracyLevel, *dbus.Error) {
+	if desktopId == "" {
+		return geoclue2.GClueAccuracyLevelNone, makeError(geoclue2.DBusErrorAccessDenied, "'DesktopId' property must be set")
+	}
+	if s.denied[desktopId] {
+		return geoclue2.GClueAccuracyLevelNone, makeError(geoclue2.DBusErrorAccessDenied, "'%s' disallowed by agent", desktopId)
+	}
+	allowed := reqLevel
+	if agent := s.agent(); agent != "" {
+		authorized, level, err := s.authorizeByAgent(agent, desktopId, reqLevel)
+		if err != nil {
+			return geoclue2.GClueAccuracyLevelNone, makeError(geoclue2.DBusErrorAccessDenied, "'%s' disallowed, agent failed: %v", desktopId, err)
+		}
+		if !authorized {
+			return geoclue2.GClueAccuracyLevelNone, makeError(geoclue2.DBusErrorAccessDenied, "'%s' disallowed by agent", desktopId)
+		}
+		if level < allowed {
+			allowed = level
+		}
+	}
+	if s.authorize != nil {
+		authorized, level := s.authorize(desktopId, reqLevel)
+		if !authorized {
+			return geoclue2.GClueAccuracyLevelNone, makeError(geoclue2.DBusErrorAccessDenied, "'%s' disallowed by agent", desktopId)
+		}
+		if level < allowed {
+			allowed = level
+		}
+	}
+	if s.available < allowed {
+		allowed = s.available
+	}
+	return allowed, nil
+}
+
+// agent returns the unique name of the registered agent with the lowest name, or "" if there is none.
+// The fake service does not distinguish users, so the agent is used for all clients.
+func (s *Service) agent() string {
+	var names []string
+	for name := range s.agents {
+		names = append(names, name)
+	}
+	if len(names) == 0 {
+		return ""
+	}
+	sort.Strings(names)
+	return names[0]
+}
+
+// authorizeByAgent calls AuthorizeApp on the agent and caps the allowed level to its MaxAccuracyLevel.
+func (s *Service) authorizeByAgent(agent string, desktopId string, reqLevel geoclue2.GClueAccuracyLevel) (bool, geoclue2.GClueAccuracyLevel, error) {
+	obj := s.conn.Object(agent, geoclue2.GeoclueAgentObjectPath)
+	var authorized bool
+	var level uint32
+	err := obj.Call(geoclue2.GeoclueAgentAuthorizeApp, 0, desktopId, uint32(reqLevel)).Store(&authorized, &level)
+	if err != nil {
+		return false, geoclue2.GClueAccuracyLevelNone, err
+	}
+	v, err := obj.GetProperty(geoclue2.GeoclueAgentPropertyMaxAccuracyLevel)
+	if err != nil {
+		return false, geoclue2.GClueAccuracyLevelNone, err
+	}
+	if maxLevel, ok := v.Value().(uint32); ok && maxLevel < level {
+		level = maxLevel
+	}
+	return authorized, geoclue2.GClueAccuracyLevel(level), nil
+}
+
+func (s *Service) watchPeers() {
+	for {
+		select {
+		case <-s.closeSignal:
+			return
+		case v, ok := <-s.sigChan:
+			if !ok {
+				return
+			}
+			if v.Name != dbusInterface+"."+dbusNameOwnerChanged || len(v.Body) != 3 {
+				continue
+			}
+			name, _ := v.Body[0].(string)
+			newOwner, _ := v.Body[2].(string)
+			if newOwner != "" {
+				continue
+			}
+			s.mu.Lock()
+			delete(s.agents, name)
+			for _, c := range s.sortedClients() {
+				if c.owner == name {
+					s.removeClient(c)
+				}
+			}
+			s.mu.Unlock()
+		}
+	}
+}
+
+func makeError(name string, format string, args ...interface{}) *dbus.Error {
+	return dbus.NewError(name, []interface{}{fmt.Sprintf(format, args...)})
+}
+
+// distance returns the great-circle distance between two locations in meters.
+func distance(a, b Location) float64 {
+	const earthRadius = 6371000
+	lat1, lat2 := a.Latitude*math.Pi/180, b.Latitude*math.Pi/180
+	dLat := lat2 - lat1
+	dLon := (b.Longitude - a.Longitude) * math.Pi / 180
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadius * math.Asin(math.Sqrt(h))
+}
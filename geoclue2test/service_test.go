@@ -0,0 +1,99 @@
+package geoclue2test_test
+
+import (
+	"errors"
+	"github.com/godbus/dbus/v5"
+	"github.com/maltegrosse/go-geoclue2"
+	"github.com/maltegrosse/go-geoclue2/geoclue2test"
+	"os/exec"
+	"testing"
+	"time"
+)
+
+// TestService talks to the fake service with plain D-Bus calls, so the fixture is checked independently
+// of the geoclue2 package it is used to test.
+func TestService(t *testing.T) {
+	bus, err := geoclue2test.NewBus()
+	if errors.Is(err, exec.ErrNotFound) {
+		t.Skip("dbus-daemon not found")
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bus.Close()
+	srvConn, err := bus.Dial()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srvConn.Close()
+	srv, err := geoclue2test.NewService(srvConn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	conn, err := bus.Dial()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	var owner string
+	err = conn.BusObject().Call("org.freedesktop.DBus.GetNameOwner", 0, geoclue2.GeoclueInterface).Store(&owner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if owner != srvConn.Names()[0] {
+		t.Errorf("%s is owned by %s, want the service connection %s", geoclue2.GeoclueInterface, owner, srvConn.Names()[0])
+	}
+
+	manager := conn.Object(geoclue2.GeoclueInterface, geoclue2.GeoclueManagerObjectPath)
+	var path dbus.ObjectPath
+	if err := manager.Call(geoclue2.GeoclueManagerGetClient, 0).Store(&path); err != nil {
+		t.Fatal(err)
+	}
+	client := conn.Object(geoclue2.GeoclueInterface, path)
+	if err := client.SetProperty(geoclue2.GeoclueClientPropertyDesktopId, dbus.MakeVariant("smoke")); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.SetProperty(geoclue2.GeoclueClientPropertyRequestedAccuracyLevel, dbus.MakeVariant(uint32(geoclue2.GClueAccuracyLevelExact))); err != nil {
+		t.Fatal(err)
+	}
+	err = conn.AddMatchSignal(dbus.WithMatchObjectPath(path), dbus.WithMatchInterface(geoclue2.GeoclueClientInterface),
+		dbus.WithMatchMember(geoclue2.GeoclueClientSignalLocationUpdated))
+	if err != nil {
+		t.Fatal(err)
+	}
+	signals := make(chan *dbus.Signal, 10)
+	conn.Signal(signals)
+	if err := client.Call(geoclue2.GeoclueClientStart, 0).Err; err != nil {
+		t.Fatal(err)
+	}
+
+	state, ok := srv.Client(path)
+	if !ok {
+		t.Fatalf("client %s not found", path)
+	}
+	if !state.Active || state.DesktopId != "smoke" || state.Owner != conn.Names()[0] ||
+		state.AllowedAccuracyLevel != geoclue2.GClueAccuracyLevelExact {
+		t.Errorf("client %+v, want the started client of the peer", state)
+	}
+
+	srv.SetLocation(geoclue2test.NewLocation(52.52, 13.40, 10))
+	var location dbus.ObjectPath
+	select {
+	case signal := <-signals:
+		if len(signal.Body) != 2 {
+			t.Fatalf("LocationUpdated %v", signal.Body)
+		}
+		location, _ = signal.Body[1].(dbus.ObjectPath)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no LocationUpdated signal")
+	}
+	v, err := conn.Object(geoclue2.GeoclueInterface, location).GetProperty(geoclue2.GeoclueLocationPropertyLatitude)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if latitude, _ := v.Value().(float64); latitude != 52.52 {
+		t.Errorf("Latitude = %v, want 52.52", v)
+	}
+}
@@ -0,0 +1,152 @@
+package geoclue2
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// GeoJSON object types
+const (
+	GeoJSONTypeFeature           = "Feature"
+	GeoJSONTypeFeatureCollection = "FeatureCollection"
+	GeoJSONTypePoint             = "Point"
+	GeoJSONTypeLineString        = "LineString"
+)
+
+// GeoJSONGeometry is a GeoJSON Point or LineString geometry (RFC 7946). Positions are [longitude, latitude]
+// or [longitude, latitude, altitude] if the altitude is known.
+type GeoJSONGeometry struct {
+	Type        string      `json:"type"`
+	Coordinates interface{} `json:"coordinates"`
+}
+
+// GeoJSONFeature is a GeoJSON Feature object. Geometry is nil for an empty track, which encodes as null.
+type GeoJSONFeature struct {
+	Type       string                 `json:"type"`
+	Geometry   *GeoJSONGeometry       `json:"geometry"`
+	Properties map[string]interface{} `json:"properties"`
+}
+
+// GeoJSONFeatureCollection is a GeoJSON FeatureCollection object.
+type GeoJSONFeatureCollection struct {
+	Type     string           `json:"type"`
+	Features []GeoJSONFeature `json:"features"`
+}
+
+// position returns the GeoJSON position, including the altitude if requested and known.
+func (l Location) position(altitude bool) []float64 {
+	if altitude && l.HasAltitude() {
+		return []float64{l.Longitude, l.Latitude, l.Altitude}
+	}
+	return []float64{l.Longitude, l.Latitude}
+}
+
+// GeoJSON returns the location as Point feature. Accuracy, speed, heading, timestamp and description are
+// set as properties, unknown values are null.
+func (l Location) GeoJSON() GeoJSONFeature {
+	properties := map[string]interface{}{
+		"accuracy":  l.Accuracy,
+		"speed":     optionalFloat64(l.Speed, l.HasSpeed()),
+		"heading":   optionalFloat64(l.Heading, l.HasHeading()),
+		"timestamp": l.Timestamp.UTC().Format(time.RFC3339Nano),
+	}
+	if l.Description != "" {
+		properties["description"] = l.Description
+	}
+	return GeoJSONFeature{
+		Type: GeoJSONTypeFeature,
+		Geometry: &GeoJSONGeometry{
+			Type:        GeoJSONTypePoint,
+			Coordinates: l.position(true),
+		},
+		Properties: properties,
+	}
+}
+
+// MarshalGeoJSON encodes the location as GeoJSON Point feature.
+func (l Location) MarshalGeoJSON() ([]byte, error) {
+	return json.Marshal(l.GeoJSON())
+}
+
+// Track is a recorded sequence of locations.
+type Track []Location
+
+// RecordTrack appends the new location of every event to a track until the channel is closed,
+// e.g. when the context passed to GeoclueClient.Watch() is done. Events with an error are skipped,
+// the first error is returned along with the track.
+func RecordTrack(events <-chan LocationEvent) (Track, error) {
+	var track Track
+	var err error
+	for event := range events {
+		if event.Err != nil {
+			if err == nil {
+				err = event.Err
+			}
+			continue
+		}
+		track = append(track, event.New)
+	}
+	return track, err
+}
+
+// GeoJSON returns the track as LineString feature. The timestamps, accuracies, speeds and headings
+// of the positions are set as array properties, in the same order as the coordinates. The altitude is
+// only included if it is known for every location, as all positions of a line must have the same dimension.
+// A LineString needs at least two positions, so a track of a single location is returned as Point and
+// an empty track without geometry.
+func (t Track) GeoJSON() GeoJSONFeature {
+	altitude := true
+	for _, l := range t {
+		if !l.HasAltitude() {
+			altitude = false
+			break
+		}
+	}
+	coordinates := make([][]float64, 0, len(t))
+	timestamps := make([]string, 0, len(t))
+	accuracies := make([]float64, 0, len(t))
+	speeds := make([]interface{}, 0, len(t))
+	headings := make([]interface{}, 0, len(t))
+	for _, l := range t {
+		coordinates = append(coordinates, l.position(altitude))
+		timestamps = append(timestamps, l.Timestamp.UTC().Format(time.RFC3339Nano))
+		accuracies = append(accuracies, l.Accuracy)
+		speeds = append(speeds, optionalFloat64(l.Speed, l.HasSpeed()))
+		headings = append(headings, optionalFloat64(l.Heading, l.HasHeading()))
+	}
+	var geometry *GeoJSONGeometry
+	switch len(coordinates) {
+	case 0:
+	case 1:
+		geometry = &GeoJSONGeometry{Type: GeoJSONTypePoint, Coordinates: coordinates[0]}
+	default:
+		geometry = &GeoJSONGeometry{Type: GeoJSONTypeLineString, Coordinates: coordinates}
+	}
+	return GeoJSONFeature{
+		Type:     GeoJSONTypeFeature,
+		Geometry: geometry,
+		Properties: map[string]interface{}{
+			"timestamps": timestamps,
+			"accuracies": accuracies,
+			"speeds":     speeds,
+			"headings":   headings,
+		},
+	}
+}
+
+// FeatureCollection returns the track as collection of Point features, one per location.
+func (t Track) FeatureCollection() GeoJSONFeatureCollection {
+	features := make([]GeoJSONFeature, 0, len(t))
+	for _, l := range t {
+		features = append(features, l.GeoJSON())
+	}
+	return GeoJSONFeatureCollection{
+		Type:     GeoJSONTypeFeatureCollection,
+		Features: features,
+	}
+}
+
+// MarshalGeoJSON encodes the track as GeoJSON feature, see GeoJSON().
+func (t Track) MarshalGeoJSON() ([]byte, error) {
+	return json.Marshal(t.GeoJSON())
+}
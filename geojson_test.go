@@ -0,0 +1,49 @@
+package geoclue2_test
+
+import (
+	"encoding/json"
+	"github.com/maltegrosse/go-geoclue2"
+	"testing"
+	"time"
+)
+
+func TestTrackGeoJSON(t *testing.T) {
+	at := func(lon, lat, alt float64) geoclue2.Location {
+		return geoclue2.Location{
+			Longitude: lon,
+			Latitude:  lat,
+			Altitude:  alt,
+			Accuracy:  10,
+			Speed:     geoclue2.UnknownSpeed,
+			Heading:   geoclue2.UnknownHeading,
+			Timestamp: time.Unix(1600000000, 0),
+		}
+	}
+	tests := []struct {
+		name  string
+		track geoclue2.Track
+		want  string
+	}{
+		{"empty", nil, `null`},
+		{"single location", geoclue2.Track{at(1, 2, 3)}, `{"type":"Point","coordinates":[1,2,3]}`},
+		{"altitudes", geoclue2.Track{at(1, 2, 3), at(4, 5, 6)},
+			`{"type":"LineString","coordinates":[[1,2,3],[4,5,6]]}`},
+		{"missing altitude", geoclue2.Track{at(1, 2, 3), at(4, 5, geoclue2.UnknownAltitude)},
+			`{"type":"LineString","coordinates":[[1,2],[4,5]]}`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			feature := test.track.GeoJSON()
+			geometry, err := json.Marshal(feature.Geometry)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(geometry) != test.want {
+				t.Errorf("geometry = %s, want %s", geometry, test.want)
+			}
+			if n := len(feature.Properties["timestamps"].([]string)); n != len(test.track) {
+				t.Errorf("%d timestamps, want %d", n, len(test.track))
+			}
+		})
+	}
+}
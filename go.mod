@@ -2,4 +2,8 @@ module github.com/maltegrosse/go-geoclue2
 
 go 1.13
 
-require github.com/godbus/dbus/v5 v5.0.3
+require (
+	github.com/BurntSushi/toml v1.2.0
+	github.com/godbus/dbus/v5 v5.0.3
+	github.com/gorilla/websocket v1.4.2
+)
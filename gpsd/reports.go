@@ -0,0 +1,135 @@
+package gpsd
+
+import (
+	"github.com/maltegrosse/go-geoclue2"
+	"time"
+)
+
+// Fix modes of the TPV report.
+const (
+	ModeNoFix = 1
+	Mode2D    = 2
+	Mode3D    = 3
+)
+
+// timeFormat is the ISO 8601 format used by gpsd.
+const timeFormat = "2006-01-02T15:04:05.000Z"
+
+// Version is the VERSION response, sent on connect.
+type Version struct {
+	Class      string `json:"class"`
+	Release    string `json:"release"`
+	Rev        string `json:"rev"`
+	ProtoMajor int    `json:"proto_major"`
+	ProtoMinor int    `json:"proto_minor"`
+}
+
+// Device describes the GeoClue2 position source.
+type Device struct {
+	Class     string `json:"class"`
+	Path      string `json:"path"`
+	Activated string `json:"activated,omitempty"`
+	Driver    string `json:"driver"`
+}
+
+// Devices is the DEVICES response.
+type Devices struct {
+	Class   string   `json:"class"`
+	Devices []Device `json:"devices"`
+}
+
+// Watch is the WATCH request and response.
+type Watch struct {
+	Class  string `json:"class,omitempty"`
+	Enable bool   `json:"enable"`
+	JSON   bool   `json:"json"`
+	NMEA   bool   `json:"nmea"`
+}
+
+// TPV is the time-position-velocity report. Unknown values are omitted.
+type TPV struct {
+	Class  string   `json:"class"`
+	Device string   `json:"device"`
+	Mode   int      `json:"mode"`
+	Time   string   `json:"time,omitempty"`
+	Lat    float64  `json:"lat"`
+	Lon    float64  `json:"lon"`
+	Alt    *float64 `json:"alt,omitempty"`
+	Epx    *float64 `json:"epx,omitempty"`
+	Epy    *float64 `json:"epy,omitempty"`
+	Track  *float64 `json:"track,omitempty"`
+	Speed  *float64 `json:"speed,omitempty"`
+}
+
+// Poll is the POLL response, containing the last TPV report if any.
+type Poll struct {
+	Class  string `json:"class"`
+	Time   string `json:"time"`
+	Active int    `json:"active"`
+	TPV    []TPV  `json:"tpv"`
+}
+
+// Error is sent for invalid requests.
+type Error struct {
+	Class   string `json:"class"`
+	Message string `json:"message"`
+}
+
+func newError(message string) Error {
+	return Error{Class: "ERROR", Message: message}
+}
+
+func optional(value float64, ok bool) *float64 {
+	if !ok {
+		return nil
+	}
+	return &value
+}
+
+// newTPV converts a location into a TPV report. The fix is 3D if the altitude is known, the accuracy is
+// reported as the longitude and latitude error.
+func newTPV(device string, l geoclue2.Location) TPV {
+	tpv := TPV{
+		Class:  "TPV",
+		Device: device,
+		Mode:   Mode2D,
+		Lat:    l.Latitude,
+		Lon:    l.Longitude,
+		Alt:    optional(l.Altitude, l.HasAltitude()),
+		Epx:    optional(l.Accuracy, l.Accuracy > 0),
+		Epy:    optional(l.Accuracy, l.Accuracy > 0),
+		Track:  optional(l.Heading, l.HasHeading()),
+		Speed:  optional(l.Speed, l.HasSpeed()),
+	}
+	if l.HasAltitude() {
+		tpv.Mode = Mode3D
+	}
+	if !l.Timestamp.IsZero() {
+		tpv.Time = l.Timestamp.UTC().Format(timeFormat)
+	}
+	return tpv
+}
+
+func (s *Server) version() Version {
+	return Version{Class: "VERSION", Release: Release, Rev: Release, ProtoMajor: ProtoMajor, ProtoMinor: ProtoMinor}
+}
+
+func (s *Server) devices() Devices {
+	s.mu.Lock()
+	activated := s.activated
+	s.mu.Unlock()
+	device := Device{Class: "DEVICE", Path: s.device(), Driver: "GeoClue2"}
+	// the activation time is unknown until Watch was called
+	if !activated.IsZero() {
+		device.Activated = activated.UTC().Format(timeFormat)
+	}
+	return Devices{Class: "DEVICES", Devices: []Device{device}}
+}
+
+func (s *Server) poll() Poll {
+	poll := Poll{Class: "POLL", Time: time.Now().UTC().Format(timeFormat), Active: 1, TPV: []TPV{}}
+	if last := s.lastLocation(); last != nil {
+		poll.TPV = append(poll.TPV, newTPV(s.device(), *last))
+	}
+	return poll
+}
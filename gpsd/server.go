@@ -0,0 +1,366 @@
+// Package gpsd implements a server speaking the gpsd JSON protocol, fed by a GeoclueClient.
+// It lets gpsd-aware applications like cgps, foxtrotgps or Navit use GeoClue2 as position source.
+//
+// The VERSION, DEVICES, WATCH and POLL requests are supported. Watching clients receive a TPV report
+// for every location update, and the NMEA sentences of the nmea package if requested.
+package gpsd
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/maltegrosse/go-geoclue2"
+	"github.com/maltegrosse/go-geoclue2/nmea"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultAddress is the address gpsd listens on.
+	DefaultAddress = "127.0.0.1:2947"
+	// DefaultDevice is the device path reported to the clients.
+	DefaultDevice = "geoclue"
+
+	// Release is the release reported in the VERSION response.
+	Release = "3.20"
+	// ProtoMajor and ProtoMinor are the reported protocol version.
+	ProtoMajor = 3
+	ProtoMinor = 14
+)
+
+// queueSize is the number of pending reports per connection, a connection is closed if it is exceeded.
+const queueSize = 32
+
+// ErrServerClosed is returned by Serve after Close was called.
+var ErrServerClosed = errors.New("gpsd: server closed")
+
+// Server serves the locations of a GeoclueClient to gpsd clients. The client is not started by the server.
+type Server struct {
+	// The device path reported to the clients, DefaultDevice if empty.
+	Device string
+	// Called for location updates which could not be read and failed connections. May be nil.
+	OnError func(error)
+
+	client    geoclue2.GeoclueClient
+	activated time.Time
+
+	mu       sync.Mutex
+	last     *geoclue2.Location
+	conns    map[*conn]struct{}
+	listener net.Listener
+	closed   bool
+	watching bool
+}
+
+// NewServer returns a server for the locations of client.
+func NewServer(client geoclue2.GeoclueClient) *Server {
+	return &Server{client: client, conns: make(map[*conn]struct{})}
+}
+
+// ListenAndServe listens on the TCP address addr, DefaultAddress if empty, and calls Serve.
+func (s *Server) ListenAndServe(ctx context.Context, addr string) error {
+	if addr == "" {
+		addr = DefaultAddress
+	}
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(ctx, l)
+}
+
+// Watch subscribes to the location updates of the client until ctx is done. Serve calls it, if it was not
+// called before. Call it before the client is started, to not miss the first location.
+func (s *Server) Watch(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.watching {
+		return nil
+	}
+	events, err := s.client.Watch(ctx)
+	if err != nil {
+		return err
+	}
+	s.watching = true
+	s.activated = time.Now()
+	go s.watch(events)
+	return nil
+}
+
+// Serve accepts connections on l until ctx is done or Close is called. The listener is closed on return.
+func (s *Server) Serve(ctx context.Context, l net.Listener) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		_ = l.Close()
+		return ErrServerClosed
+	}
+	s.listener = l
+	s.mu.Unlock()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	if err := s.Watch(ctx); err != nil {
+		_ = l.Close()
+		return err
+	}
+	go func() {
+		<-ctx.Done()
+		_ = l.Close()
+	}()
+
+	for {
+		c, err := l.Accept()
+		if err != nil {
+			s.closeConns()
+			s.mu.Lock()
+			closed := s.closed
+			s.mu.Unlock()
+			if closed {
+				return ErrServerClosed
+			}
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+		s.serveConn(c)
+	}
+}
+
+// Close closes the listener and all connections.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	l := s.listener
+	s.mu.Unlock()
+	s.closeConns()
+	if l != nil {
+		return l.Close()
+	}
+	return nil
+}
+
+func (s *Server) device() string {
+	if s.Device == "" {
+		return DefaultDevice
+	}
+	return s.Device
+}
+
+func (s *Server) onError(err error) {
+	if s.OnError != nil {
+		s.OnError(err)
+	}
+}
+
+func (s *Server) watch(events <-chan geoclue2.LocationEvent) {
+	defer func() {
+		s.mu.Lock()
+		s.watching = false
+		s.mu.Unlock()
+	}()
+	for event := range events {
+		if event.Err != nil {
+			s.onError(event.Err)
+			continue
+		}
+		location := event.New
+		s.mu.Lock()
+		s.last = &location
+		conns := make([]*conn, 0, len(s.conns))
+		for c := range s.conns {
+			conns = append(conns, c)
+		}
+		s.mu.Unlock()
+		for _, c := range conns {
+			c.report(&location)
+		}
+	}
+}
+
+func (s *Server) serveConn(nc net.Conn) {
+	c := &conn{s: s, nc: nc, queue: make(chan []byte, queueSize), done: make(chan struct{})}
+	s.mu.Lock()
+	s.conns[c] = struct{}{}
+	s.mu.Unlock()
+	go c.writeLoop()
+	go c.readLoop()
+}
+
+func (s *Server) closeConns() {
+	s.mu.Lock()
+	conns := s.conns
+	s.conns = make(map[*conn]struct{})
+	s.mu.Unlock()
+	for c := range conns {
+		c.close()
+	}
+}
+
+func (s *Server) lastLocation() *geoclue2.Location {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.last
+}
+
+// conn is a single client connection.
+type conn struct {
+	s     *Server
+	nc    net.Conn
+	queue chan []byte
+	done  chan struct{}
+	once  sync.Once
+
+	mu    sync.Mutex
+	watch Watch
+	// the location last reported, so a location is not reported twice by WATCH and the broadcast
+	reported *geoclue2.Location
+}
+
+func (c *conn) close() {
+	c.once.Do(func() {
+		close(c.done)
+		_ = c.nc.Close()
+		c.s.mu.Lock()
+		delete(c.s.conns, c)
+		c.s.mu.Unlock()
+	})
+}
+
+// send queues a line, the connection is closed if the client does not keep up.
+func (c *conn) send(line []byte) {
+	select {
+	case c.queue <- line:
+	case <-c.done:
+	default:
+		c.s.onError(fmt.Errorf("gpsd: closing slow connection %v", c.nc.RemoteAddr()))
+		c.close()
+	}
+}
+
+func (c *conn) sendJSON(v interface{}) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		c.s.onError(err)
+		return
+	}
+	c.send(append(b, '\r', '\n'))
+}
+
+func (c *conn) report(location *geoclue2.Location) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.reportLocked(location)
+}
+
+// reportLocked sends the location if the connection is watching and did not receive it yet. c.mu must be held.
+func (c *conn) reportLocked(location *geoclue2.Location) {
+	if !c.watch.Enable || location == nil || location == c.reported {
+		return
+	}
+	c.reported = location
+	if c.watch.JSON {
+		c.sendJSON(newTPV(c.s.device(), *location))
+	}
+	if c.watch.NMEA {
+		for _, sentence := range nmea.Sentences(*location) {
+			c.send([]byte(sentence + "\r\n"))
+		}
+	}
+}
+
+func (c *conn) writeLoop() {
+	for {
+		select {
+		case line := <-c.queue:
+			if _, err := c.nc.Write(line); err != nil {
+				c.close()
+				return
+			}
+		case <-c.done:
+			return
+		}
+	}
+}
+
+func (c *conn) readLoop() {
+	defer c.close()
+	c.sendJSON(c.s.version())
+	scanner := bufio.NewScanner(c.nc)
+	for scanner.Scan() {
+		for _, request := range splitRequests(scanner.Text()) {
+			c.handle(request)
+		}
+	}
+}
+
+// splitRequests splits a line into requests, which start with '?' and are terminated by ';' or the line end.
+func splitRequests(line string) []string {
+	var requests []string
+	for _, request := range strings.Split(line, ";") {
+		request = strings.TrimSpace(request)
+		if request != "" {
+			requests = append(requests, request)
+		}
+	}
+	return requests
+}
+
+func (c *conn) handle(request string) {
+	command, args := request, ""
+	if idx := strings.IndexByte(request, '='); idx != -1 {
+		command, args = request[:idx], request[idx+1:]
+	}
+	switch command {
+	case "?VERSION":
+		c.sendJSON(c.s.version())
+	case "?DEVICES":
+		c.sendJSON(c.s.devices())
+	case "?WATCH":
+		c.handleWatch(args)
+	case "?POLL":
+		c.sendJSON(c.s.poll())
+	default:
+		c.sendJSON(newError(fmt.Sprintf("Unrecognized request '%s'", strings.TrimPrefix(command, "?"))))
+	}
+}
+
+// handleWatch answers a WATCH request. DEVICES, the WATCH response and the last location are sent before the
+// watch is enabled for the broadcast, all while holding c.mu, so no TPV report overtakes the WATCH response.
+func (c *conn) handleWatch(args string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	w := c.watch
+	if args != "" {
+		// like gpsd, a WATCH object enables the watch of JSON reports unless it says otherwise
+		w.Enable, w.JSON = true, true
+		if err := json.Unmarshal([]byte(args), &w); err != nil {
+			c.sendJSON(newError("Invalid WATCH: " + err.Error()))
+			return
+		}
+		if !w.Enable {
+			w.JSON, w.NMEA = false, false
+		}
+	}
+	if w.Enable {
+		c.sendJSON(c.s.devices())
+	}
+	response := w
+	response.Class = "WATCH"
+	c.sendJSON(response)
+	if args == "" {
+		return
+	}
+	c.watch = w
+	if !w.Enable {
+		// the location is reported again, when the watch is enabled again
+		c.reported = nil
+		return
+	}
+	c.reportLocked(c.s.lastLocation())
+}
@@ -0,0 +1,188 @@
+package gpsd_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/maltegrosse/go-geoclue2"
+	"github.com/maltegrosse/go-geoclue2/geoclue2test"
+	"github.com/maltegrosse/go-geoclue2/gpsd"
+	"net"
+	"os/exec"
+	"testing"
+	"time"
+)
+
+const timeout = 5 * time.Second
+
+// session is a connection to a gpsd server fed by the fake GeoClue2 service.
+type session struct {
+	t      *testing.T
+	srv    *geoclue2test.Service
+	nc     net.Conn
+	reader *bufio.Reader
+}
+
+// newSession starts the fake service, a started client and a server for it, and connects to the server.
+// The test is skipped if dbus-daemon is not installed. The returned function cleans everything up.
+func newSession(t *testing.T) (*session, func()) {
+	t.Helper()
+	bus, err := geoclue2test.NewBus()
+	if errors.Is(err, exec.ErrNotFound) {
+		t.Skip("dbus-daemon not found")
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	var closers []func()
+	cleanup := func() {
+		cancel()
+		for i := len(closers) - 1; i >= 0; i-- {
+			closers[i]()
+		}
+		bus.Close()
+	}
+	fail := func(err error) {
+		t.Helper()
+		cleanup()
+		t.Fatal(err)
+	}
+
+	srvConn, err := bus.Dial()
+	if err != nil {
+		fail(err)
+	}
+	closers = append(closers, func() { srvConn.Close() })
+	srv, err := geoclue2test.NewService(srvConn)
+	if err != nil {
+		fail(err)
+	}
+	conn, err := bus.Dial()
+	if err != nil {
+		fail(err)
+	}
+	closers = append(closers, func() { conn.Close() })
+	gcm, err := geoclue2.NewGeoclueManager(geoclue2.WithConn(conn))
+	if err != nil {
+		fail(err)
+	}
+	client, err := gcm.Open(ctx, geoclue2.ClientConfig{DesktopId: "gpsd", RequestedAccuracyLevel: geoclue2.GClueAccuracyLevelExact})
+	if err != nil {
+		fail(err)
+	}
+	closers = append(closers, func() { client.Close() })
+
+	server := gpsd.NewServer(client)
+	if err := server.Watch(ctx); err != nil {
+		fail(err)
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		fail(err)
+	}
+	go server.Serve(ctx, l)
+	closers = append(closers, func() { server.Close() })
+	nc, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		fail(err)
+	}
+	closers = append(closers, func() { nc.Close() })
+	return &session{t: t, srv: srv, nc: nc, reader: bufio.NewReader(nc)}, cleanup
+}
+
+func (s *session) send(request string) {
+	s.t.Helper()
+	if _, err := s.nc.Write([]byte(request + "\n")); err != nil {
+		s.t.Fatal(err)
+	}
+}
+
+// receive reads the next report, checks its class and decodes it into v.
+func (s *session) receive(class string, v interface{}) {
+	s.t.Helper()
+	s.nc.SetReadDeadline(time.Now().Add(timeout))
+	line, err := s.reader.ReadBytes('\n')
+	if err != nil {
+		s.t.Fatalf("waiting for %s: %v", class, err)
+	}
+	var report struct {
+		Class string `json:"class"`
+	}
+	if err := json.Unmarshal(line, &report); err != nil {
+		s.t.Fatalf("%s: %v", line, err)
+	}
+	if report.Class != class {
+		s.t.Fatalf("received %s, want class %s", line, class)
+	}
+	if v != nil {
+		if err := json.Unmarshal(line, v); err != nil {
+			s.t.Fatalf("%s: %v", line, err)
+		}
+	}
+}
+
+func TestServer(t *testing.T) {
+	s, cleanup := newSession(t)
+	defer cleanup()
+
+	var version gpsd.Version
+	s.receive("VERSION", &version)
+	if version.ProtoMajor != gpsd.ProtoMajor || version.Release != gpsd.Release {
+		t.Errorf("VERSION = %+v", version)
+	}
+
+	// a WATCH object enables the watch with JSON reports by default
+	s.srv.SetLocation(geoclue2test.NewLocation(52.52, 13.40, 10))
+	s.send(`?WATCH={"class":"WATCH"};`)
+	var devices gpsd.Devices
+	s.receive("DEVICES", &devices)
+	if len(devices.Devices) != 1 || devices.Devices[0].Path != gpsd.DefaultDevice || devices.Devices[0].Activated == "" {
+		t.Errorf("DEVICES = %+v", devices)
+	}
+	var watch gpsd.Watch
+	s.receive("WATCH", &watch)
+	if !watch.Enable || !watch.JSON || watch.NMEA {
+		t.Errorf("WATCH = %+v, want enabled JSON reports", watch)
+	}
+	var tpv gpsd.TPV
+	s.receive("TPV", &tpv)
+	if tpv.Lat != 52.52 || tpv.Lon != 13.40 || tpv.Mode != gpsd.Mode2D || tpv.Device != gpsd.DefaultDevice {
+		t.Errorf("TPV = %+v", tpv)
+	}
+	// the location is reported once
+	s.send("?VERSION;")
+	s.receive("VERSION", nil)
+
+	s.srv.SetLocation(geoclue2test.NewLocation(48.14, 11.58, 10))
+	s.receive("TPV", &tpv)
+	if tpv.Lat != 48.14 || tpv.Lon != 11.58 {
+		t.Errorf("TPV after update = %+v", tpv)
+	}
+
+	s.send("?POLL;")
+	var poll gpsd.Poll
+	s.receive("POLL", &poll)
+	if len(poll.TPV) != 1 || poll.TPV[0].Lat != 48.14 {
+		t.Errorf("POLL = %+v", poll)
+	}
+
+	s.send("?FOO;")
+	var gpsdErr gpsd.Error
+	s.receive("ERROR", &gpsdErr)
+	if gpsdErr.Message != "Unrecognized request 'FOO'" {
+		t.Errorf("ERROR = %+v", gpsdErr)
+	}
+
+	s.send(`?WATCH={"enable":false};?VERSION;`)
+	s.receive("WATCH", &watch)
+	if watch.Enable || watch.JSON {
+		t.Errorf("WATCH = %+v, want disabled", watch)
+	}
+	s.receive("VERSION", nil)
+	s.srv.SetLocation(geoclue2test.NewLocation(1, 2, 10))
+	s.send("?VERSION;")
+	// no TPV is sent after disabling the watch
+	s.receive("VERSION", nil)
+}
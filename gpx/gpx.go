@@ -0,0 +1,180 @@
+// Package gpx writes GeoClue2 locations as GPX 1.1 tracks.
+//
+// Speed and course are written with the Garmin TrackPointExtension v2, the accuracy of each fix in meters
+// with an extension in the go-geoclue2 namespace. For standard GPX tools the accuracy is also written as hdop,
+// estimated like the HDOP of the nmea package (see nmea.UERE).
+package gpx
+
+import (
+	"encoding/xml"
+	"fmt"
+	"github.com/maltegrosse/go-geoclue2"
+	"github.com/maltegrosse/go-geoclue2/nmea"
+	"io"
+	"math"
+	"time"
+)
+
+// XML namespaces used in the written documents
+const (
+	NamespaceGPX                 = "http://www.topografix.com/GPX/1/1"
+	NamespaceTrackPointExtension = "http://www.garmin.com/xmlschemas/TrackPointExtension/v2"
+	NamespaceGeoclue             = "https://github.com/maltegrosse/go-geoclue2/gpx"
+)
+
+const header = xml.Header + `<gpx version="1.1" creator="go-geoclue2" xmlns="` + NamespaceGPX + `" xmlns:gpxtpx="` +
+	NamespaceTrackPointExtension + `" xmlns:geoclue="` + NamespaceGeoclue + `">
+`
+
+type trkpt struct {
+	XMLName     xml.Name    `xml:"trkpt"`
+	Lat         float64     `xml:"lat,attr"`
+	Lon         float64     `xml:"lon,attr"`
+	Ele         *float64    `xml:"ele,omitempty"`
+	Time        string      `xml:"time"`
+	Description string      `xml:"desc,omitempty"`
+	Hdop        *float64    `xml:"hdop,omitempty"`
+	Extensions  *extensions `xml:"extensions"`
+}
+
+type extensions struct {
+	TrackPoint *trackPointExtension `xml:"gpxtpx:TrackPointExtension,omitempty"`
+	Accuracy   float64              `xml:"geoclue:accuracy"`
+}
+
+type trackPointExtension struct {
+	Speed  *float64 `xml:"gpxtpx:speed,omitempty"`
+	Course *float64 `xml:"gpxtpx:course,omitempty"`
+}
+
+func newTrkpt(l geoclue2.Location) trkpt {
+	p := trkpt{
+		Lat:         l.Latitude,
+		Lon:         l.Longitude,
+		Time:        l.Timestamp.UTC().Format(time.RFC3339Nano),
+		Description: l.Description,
+		Extensions:  &extensions{Accuracy: l.Accuracy},
+	}
+	if l.Accuracy > 0 {
+		hdop := math.Round(l.Accuracy/nmea.UERE*10) / 10
+		p.Hdop = &hdop
+	}
+	if l.HasAltitude() {
+		ele := l.Altitude
+		p.Ele = &ele
+	}
+	if l.HasSpeed() || l.HasHeading() {
+		p.Extensions.TrackPoint = &trackPointExtension{}
+		if l.HasSpeed() {
+			speed := l.Speed
+			p.Extensions.TrackPoint.Speed = &speed
+		}
+		if l.HasHeading() {
+			course := l.Heading
+			p.Extensions.TrackPoint.Course = &course
+		}
+	}
+	return p
+}
+
+// Writer writes a GPX document with a single track, point by point. Call Close to finish the document.
+type Writer struct {
+	w         io.Writer
+	enc       *xml.Encoder
+	started   bool
+	inSegment bool
+	closed    bool
+	name      string
+}
+
+// NewWriter returns a writer for a track with the given name, which may be empty.
+func NewWriter(w io.Writer, name string) *Writer {
+	return &Writer{w: w, enc: xml.NewEncoder(w), name: name}
+}
+
+func (gw *Writer) writeString(s string) error {
+	_, err := io.WriteString(gw.w, s)
+	return err
+}
+
+func (gw *Writer) start() error {
+	if gw.started {
+		return nil
+	}
+	gw.started = true
+	err := gw.writeString(header + "<trk>")
+	if err != nil {
+		return err
+	}
+	if gw.name != "" {
+		err = gw.enc.EncodeElement(gw.name, xml.StartElement{Name: xml.Name{Local: "name"}})
+	}
+	return err
+}
+
+// WritePoint writes the location as track point, starting a new segment if necessary.
+func (gw *Writer) WritePoint(l geoclue2.Location) error {
+	if gw.closed {
+		return fmt.Errorf("gpx: writer is closed")
+	}
+	err := gw.start()
+	if err != nil {
+		return err
+	}
+	if !gw.inSegment {
+		err = gw.writeString("<trkseg>")
+		if err != nil {
+			return err
+		}
+		gw.inSegment = true
+	}
+	err = gw.enc.Encode(newTrkpt(l))
+	if err != nil {
+		return err
+	}
+	return gw.enc.Flush()
+}
+
+// EndSegment ends the current track segment, the next point starts a new one.
+func (gw *Writer) EndSegment() error {
+	if !gw.inSegment {
+		return nil
+	}
+	gw.inSegment = false
+	return gw.writeString("</trkseg>\n")
+}
+
+// Close ends the document. It does not close the underlying writer.
+func (gw *Writer) Close() error {
+	if gw.closed {
+		return nil
+	}
+	err := gw.start()
+	if err != nil {
+		return err
+	}
+	err = gw.EndSegment()
+	if err != nil {
+		return err
+	}
+	gw.closed = true
+	return gw.writeString("</trk>\n</gpx>\n")
+}
+
+// WriteTrack writes a complete GPX document with one track segment per given track.
+func WriteTrack(w io.Writer, name string, segments ...geoclue2.Track) error {
+	gw := NewWriter(w, name)
+	for _, segment := range segments {
+		for _, l := range segment {
+			err := gw.WritePoint(l)
+			if err != nil {
+				return err
+			}
+		}
+		err := gw.EndSegment()
+		if err != nil {
+			return err
+		}
+	}
+	return gw.Close()
+}
@@ -0,0 +1,165 @@
+package gpx_test
+
+import (
+	"bytes"
+	"encoding/xml"
+	"github.com/maltegrosse/go-geoclue2"
+	"github.com/maltegrosse/go-geoclue2/gpx"
+	"io"
+	"testing"
+	"time"
+)
+
+// document is the part of a GPX 1.1 document written by the package.
+type document struct {
+	XMLName xml.Name `xml:"http://www.topografix.com/GPX/1/1 gpx"`
+	Version string   `xml:"version,attr"`
+	Creator string   `xml:"creator,attr"`
+	Track   struct {
+		Name     string `xml:"name"`
+		Segments []struct {
+			Points []point `xml:"trkpt"`
+		} `xml:"trkseg"`
+	} `xml:"trk"`
+}
+
+type point struct {
+	Lat      float64  `xml:"lat,attr"`
+	Lon      float64  `xml:"lon,attr"`
+	Ele      *float64 `xml:"ele"`
+	Time     string   `xml:"time"`
+	Desc     string   `xml:"desc"`
+	Hdop     *float64 `xml:"hdop"`
+	Speed    *float64 `xml:"extensions>TrackPointExtension>speed"`
+	Course   *float64 `xml:"extensions>TrackPointExtension>course"`
+	Accuracy float64  `xml:"extensions>accuracy"`
+}
+
+// trkptElements is the sequence of the child elements of trkpt defined by the GPX 1.1 schema.
+var trkptElements = []string{"ele", "time", "magvar", "geoidheight", "name", "cmt", "desc", "src", "link", "sym",
+	"type", "fix", "sat", "hdop", "vdop", "pdop", "ageofdgpsdata", "dgpsid", "extensions"}
+
+// checkNamespaces checks that all elements are in the GPX namespace or, within extensions, in the namespaces of
+// the extensions, and that the children of trkpt are in schema order.
+func checkNamespaces(t *testing.T, data []byte) {
+	t.Helper()
+	order := make(map[string]int, len(trkptElements))
+	for i, name := range trkptElements {
+		order[name] = i
+	}
+	d := xml.NewDecoder(bytes.NewReader(data))
+	var stack []xml.Name
+	last := -1
+	for {
+		token, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		switch token := token.(type) {
+		case xml.StartElement:
+			inExtensions := false
+			for _, name := range stack {
+				if name.Local == "extensions" {
+					inExtensions = true
+				}
+			}
+			switch {
+			case !inExtensions && token.Name.Space != gpx.NamespaceGPX:
+				t.Errorf("element %s not in the GPX namespace", token.Name.Local)
+			case inExtensions && token.Name.Space != gpx.NamespaceTrackPointExtension && token.Name.Space != gpx.NamespaceGeoclue:
+				t.Errorf("extension %s in undeclared namespace %q", token.Name.Local, token.Name.Space)
+			}
+			if len(stack) > 0 && stack[len(stack)-1].Local == "trkpt" {
+				idx, ok := order[token.Name.Local]
+				if !ok || idx <= last {
+					t.Errorf("trkpt element %s out of the schema order", token.Name.Local)
+				}
+				last = idx
+			}
+			if token.Name.Local == "trkpt" {
+				last = -1
+			}
+			stack = append(stack, token.Name)
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+		}
+	}
+}
+
+func TestWriteTrack(t *testing.T) {
+	timestamp := time.Date(2020, 9, 13, 12, 35, 19, 0, time.UTC)
+	moving := geoclue2.Location{
+		Latitude:    48.1173,
+		Longitude:   11.5167,
+		Accuracy:    10,
+		Altitude:    545.4,
+		Speed:       12.5,
+		Heading:     84.4,
+		Description: "WiFi",
+		Timestamp:   timestamp,
+	}
+	unknown := geoclue2.Location{
+		Latitude:  48.1174,
+		Longitude: 11.5168,
+		Altitude:  geoclue2.UnknownAltitude,
+		Speed:     geoclue2.UnknownSpeed,
+		Heading:   geoclue2.UnknownHeading,
+		Timestamp: timestamp.Add(time.Second),
+	}
+	var buf bytes.Buffer
+	err := gpx.WriteTrack(&buf, "walk", geoclue2.Track{moving, unknown}, geoclue2.Track{moving})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkNamespaces(t, buf.Bytes())
+
+	var doc document
+	if err := xml.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatalf("%v\n%s", err, buf.Bytes())
+	}
+	if doc.Version != "1.1" || doc.Creator == "" || doc.Track.Name != "walk" {
+		t.Errorf("document version %q, creator %q, track %q", doc.Version, doc.Creator, doc.Track.Name)
+	}
+	if len(doc.Track.Segments) != 2 || len(doc.Track.Segments[0].Points) != 2 || len(doc.Track.Segments[1].Points) != 1 {
+		t.Fatalf("segments %+v, want 2 and 1 points", doc.Track.Segments)
+	}
+	p := doc.Track.Segments[0].Points[0]
+	if p.Lat != 48.1173 || p.Lon != 11.5167 || p.Time != "2020-09-13T12:35:19Z" || p.Desc != "WiFi" || p.Accuracy != 10 {
+		t.Errorf("point %+v", p)
+	}
+	if p.Ele == nil || *p.Ele != 545.4 || p.Speed == nil || *p.Speed != 12.5 || p.Course == nil || *p.Course != 84.4 {
+		t.Errorf("point %+v, want elevation, speed and course", p)
+	}
+	if p.Hdop == nil || *p.Hdop != 2 {
+		t.Errorf("point %+v, want hdop 2", p)
+	}
+	p = doc.Track.Segments[0].Points[1]
+	if p.Ele != nil || p.Speed != nil || p.Course != nil || p.Hdop != nil {
+		t.Errorf("point %+v, want no elevation, speed, course and hdop", p)
+	}
+}
+
+func TestWriterEmpty(t *testing.T) {
+	var buf bytes.Buffer
+	gw := gpx.NewWriter(&buf, "")
+	if err := gw.EndSegment(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	checkNamespaces(t, buf.Bytes())
+	var doc document
+	if err := xml.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatalf("%v\n%s", err, buf.Bytes())
+	}
+	if len(doc.Track.Segments) != 0 {
+		t.Errorf("segments %+v, want none", doc.Track.Segments)
+	}
+	if err := gw.WritePoint(geoclue2.Location{}); err == nil {
+		t.Error("WritePoint() after Close() succeeded")
+	}
+}
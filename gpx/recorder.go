@@ -0,0 +1,72 @@
+package gpx
+
+import (
+	"context"
+	"github.com/maltegrosse/go-geoclue2"
+	"io"
+)
+
+// Recorder writes the locations of a GeoclueClient as GPX track. A new track segment is started whenever
+// the client became inactive in between, e.g. because it was stopped or the agent revoked the authorization.
+type Recorder struct {
+	// The name of the track, may be empty.
+	Name string
+	// Called for events which could not be read, they are skipped. May be nil.
+	OnError func(error)
+
+	w io.Writer
+}
+
+// NewRecorder returns a recorder writing to w.
+func NewRecorder(w io.Writer) *Recorder {
+	return &Recorder{w: w}
+}
+
+// Record subscribes to the location updates of the client and writes them until ctx is done,
+// then completes the GPX document. The client should be started after Record was called, or be already active.
+// Write errors are returned immediately.
+func (r *Recorder) Record(ctx context.Context, client geoclue2.GeoclueClient) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	events, err := client.Watch(ctx)
+	if err != nil {
+		return err
+	}
+	activeEvents, err := client.WatchActive(ctx)
+	if err != nil {
+		return err
+	}
+
+	gw := NewWriter(r.w, r.Name)
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				return gw.Close()
+			}
+			if event.Err != nil {
+				if r.OnError != nil {
+					r.OnError(event.Err)
+				}
+				continue
+			}
+			err = gw.WritePoint(event.New)
+		case event, ok := <-activeEvents:
+			if !ok {
+				return gw.Close()
+			}
+			if event.Err != nil {
+				if r.OnError != nil {
+					r.OnError(event.Err)
+				}
+				continue
+			}
+			if !event.Active {
+				err = gw.EndSegment()
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
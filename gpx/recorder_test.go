@@ -0,0 +1,142 @@
+package gpx_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"github.com/maltegrosse/go-geoclue2"
+	"github.com/maltegrosse/go-geoclue2/geoclue2test"
+	"github.com/maltegrosse/go-geoclue2/gpx"
+	"os/exec"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const timeout = 5 * time.Second
+
+// syncBuffer is a buffer, which can be read while the recorder writes to it.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// waitFor waits until the buffer contains s, calling f meanwhile if not nil.
+func (b *syncBuffer) waitFor(t *testing.T, s string, f func()) {
+	t.Helper()
+	for deadline := time.Now().Add(timeout); time.Now().Before(deadline); time.Sleep(20 * time.Millisecond) {
+		if strings.Contains(b.String(), s) {
+			return
+		}
+		if f != nil {
+			f()
+		}
+	}
+	t.Fatalf("%q not written:\n%s", s, b.String())
+}
+
+func TestRecorder(t *testing.T) {
+	bus, err := geoclue2test.NewBus()
+	if errors.Is(err, exec.ErrNotFound) {
+		t.Skip("dbus-daemon not found")
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bus.Close()
+	srvConn, err := bus.Dial()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srvConn.Close()
+	srv, err := geoclue2test.NewService(srvConn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := bus.Dial()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	gcm, err := geoclue2.NewGeoclueManager(geoclue2.WithConn(conn))
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := gcm.CreateClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.SetDesktopId("gpx"); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.SetRequestedAccuracyLevel(geoclue2.GClueAccuracyLevelExact); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf syncBuffer
+	r := gpx.NewRecorder(&buf)
+	r.Name = "recorded"
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	errs := make(chan error, 1)
+	go func() {
+		errs <- r.Record(ctx, client)
+	}()
+
+	// the recorder subscribes asynchronously, update the location until it records the first point
+	buf.waitFor(t, "<trkpt", func() { srv.SetLocation(geoclue2test.NewLocation(1, 1, 10)) })
+	// an inactive client ends the segment
+	if err := client.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	buf.waitFor(t, "</trkseg>", nil)
+	// the next location starts a new segment
+	if err := client.Start(); err != nil {
+		t.Fatal(err)
+	}
+	srv.SetLocation(geoclue2test.NewLocation(2, 2, 10))
+	buf.waitFor(t, `lat="2"`, nil)
+
+	cancel()
+	select {
+	case err := <-errs:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(timeout):
+		t.Fatal("Record() did not return")
+	}
+	var doc document
+	if err := xml.Unmarshal([]byte(buf.String()), &doc); err != nil {
+		t.Fatalf("%v\n%s", err, buf.String())
+	}
+	if doc.Track.Name != "recorded" || len(doc.Track.Segments) != 2 {
+		t.Fatalf("track %+v, want 2 segments", doc.Track)
+	}
+	for _, p := range doc.Track.Segments[0].Points {
+		if p.Lat != 1 {
+			t.Errorf("point %+v in the first segment, want latitude 1", p)
+		}
+	}
+	points := doc.Track.Segments[1].Points
+	if len(points) == 0 || points[len(points)-1].Lat != 2 {
+		t.Errorf("points %+v in the second segment, want the location after the restart", points)
+	}
+}
@@ -0,0 +1,224 @@
+// Package httpapi bridges GeoClue2 to HTTP, for browsers and other clients which cannot reach D-Bus.
+//
+// The Handler serves the following endpoints:
+//
+//	GET /location  the last location as JSON, 503 until the first location is known
+//	GET /status    the InUse and AvailableAccuracyLevel properties of the manager and whether the client is active
+//	GET /events    a text/event-stream of "location" events, starting with the last location
+//
+// The handler can be mounted below a prefix with http.StripPrefix.
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/maltegrosse/go-geoclue2"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// KeepAliveInterval is the interval of the comments sent on idle event streams, to keep proxies from
+// closing the connection.
+const KeepAliveInterval = 15 * time.Second
+
+// Errors returned by Start and Close
+var (
+	// ErrStarted is returned by Start if the handler was already started.
+	ErrStarted = errors.New("httpapi: handler already started")
+	// ErrNotStarted is returned by Close if the handler was not started.
+	ErrNotStarted = errors.New("httpapi: handler not started")
+)
+
+// Handler is an http.Handler serving the location of a GeoClue2 client, which it creates with the configured
+// desktop id and accuracy level on Start.
+type Handler struct {
+	// The desktop id of the client, required by geoclue to authorize it.
+	DesktopId string
+	// The requested accuracy level of the client.
+	AccuracyLevel geoclue2.GClueAccuracyLevel
+	// The distance threshold in meters and time threshold in seconds of the client, 0 for none.
+	DistanceThreshold uint32
+	TimeThreshold     uint32
+	// Called for location updates which could not be read. May be nil.
+	OnError func(error)
+
+	manager geoclue2.GeoclueManager
+	mux     *http.ServeMux
+
+	mu       sync.Mutex
+	stream   *stream
+	starting bool
+}
+
+// NewHandler returns a handler using the given manager. Start must be called before serving requests.
+func NewHandler(manager geoclue2.GeoclueManager, desktopId string, level geoclue2.GClueAccuracyLevel) *Handler {
+	h := &Handler{
+		DesktopId:     desktopId,
+		AccuracyLevel: level,
+		manager:       manager,
+		mux:           http.NewServeMux(),
+	}
+	h.mux.HandleFunc("/location", h.serveLocation)
+	h.mux.HandleFunc("/status", h.serveStatus)
+	h.mux.HandleFunc("/events", h.serveEvents)
+	return h
+}
+
+// Start creates and configures the client, watches its location updates and starts it.
+// The client is deleted again on failure. ErrStarted is returned if the handler was already started and not
+// closed since.
+func (h *Handler) Start(ctx context.Context) error {
+	h.mu.Lock()
+	if h.stream != nil || h.starting {
+		h.mu.Unlock()
+		return ErrStarted
+	}
+	h.starting = true
+	h.mu.Unlock()
+
+	settings := Settings{AccuracyLevel: h.AccuracyLevel, DistanceThreshold: h.DistanceThreshold, TimeThreshold: h.TimeThreshold}
+	s, err := startStream(ctx, h.manager, h.DesktopId, settings, h.OnError)
+	h.mu.Lock()
+	h.starting = false
+	h.stream = s
+	h.mu.Unlock()
+	return err
+}
+
+// Close stops and deletes the client. Running event streams are ended.
+func (h *Handler) Close() error {
+	h.mu.Lock()
+	s := h.stream
+	h.stream = nil
+	h.mu.Unlock()
+	if s == nil {
+		return ErrNotStarted
+	}
+	return s.close()
+}
+
+func (h *Handler) currentStream() *stream {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.stream
+}
+
+// ServeHTTP implements http.Handler.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	h.mux.ServeHTTP(w, r)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	_, _ = w.Write(b)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	b, _ := json.Marshal(map[string]string{"Error": message})
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, _ = w.Write(b)
+}
+
+func (h *Handler) serveLocation(w http.ResponseWriter, r *http.Request) {
+	var last *geoclue2.Location
+	if s := h.currentStream(); s != nil {
+		last = s.lastLocation()
+	}
+	if last == nil {
+		writeError(w, http.StatusServiceUnavailable, "location not known yet")
+		return
+	}
+	writeJSON(w, http.StatusOK, last)
+}
+
+func (h *Handler) serveStatus(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	inUse, err := h.manager.InUseWithContext(ctx)
+	if err != nil {
+		writeError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+	level, err := h.manager.GetAvailableAccuracyLevelWithContext(ctx)
+	if err != nil {
+		writeError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+	active := false
+	if s := h.currentStream(); s != nil {
+		active, err = s.client.IsActiveWithContext(ctx)
+		if err != nil {
+			writeError(w, http.StatusBadGateway, err.Error())
+			return
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"InUse":                  inUse,
+		"AvailableAccuracyLevel": level,
+		"Active":                 active,
+	})
+}
+
+func (h *Handler) serveEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "streaming not supported")
+		return
+	}
+	s := h.currentStream()
+	if s == nil {
+		writeError(w, http.StatusServiceUnavailable, "handler not started")
+		return
+	}
+	c := s.subscribe()
+	defer s.unsubscribe(c)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	if r.Method == http.MethodHead {
+		return
+	}
+
+	keepAlive := time.NewTicker(KeepAliveInterval)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case location, ok := <-c:
+			if !ok {
+				return
+			}
+			data, err := json.Marshal(location)
+			if err != nil {
+				return
+			}
+			if _, err := fmt.Fprintf(w, "event: location\ndata: %s\n\n", data); err != nil {
+				return
+			}
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
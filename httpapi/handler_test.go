@@ -0,0 +1,193 @@
+package httpapi_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/maltegrosse/go-geoclue2"
+	"github.com/maltegrosse/go-geoclue2/geoclue2test"
+	"github.com/maltegrosse/go-geoclue2/httpapi"
+	"net/http"
+	"net/http/httptest"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newManager starts the fake service and returns it with a manager on another connection.
+// The test is skipped if dbus-daemon is not installed. The returned function cleans everything up.
+func newManager(t *testing.T) (*geoclue2test.Service, geoclue2.GeoclueManager, func()) {
+	t.Helper()
+	bus, err := geoclue2test.NewBus()
+	if errors.Is(err, exec.ErrNotFound) {
+		t.Skip("dbus-daemon not found")
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	srvConn, err := bus.Dial()
+	if err != nil {
+		bus.Close()
+		t.Fatal(err)
+	}
+	conn, err := bus.Dial()
+	if err != nil {
+		srvConn.Close()
+		bus.Close()
+		t.Fatal(err)
+	}
+	cleanup := func() {
+		conn.Close()
+		srvConn.Close()
+		bus.Close()
+	}
+	srv, err := geoclue2test.NewService(srvConn)
+	if err != nil {
+		cleanup()
+		t.Fatal(err)
+	}
+	gcm, err := geoclue2.NewGeoclueManager(geoclue2.WithConn(conn))
+	if err != nil {
+		cleanup()
+		t.Fatal(err)
+	}
+	return srv, gcm, cleanup
+}
+
+// get requests the path and decodes the JSON response into v.
+func get(t *testing.T, url string, v interface{}) int {
+	t.Helper()
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "application/json" {
+		t.Errorf("GET %s: Content-Type %s", url, ct)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		t.Fatalf("GET %s: %v", url, err)
+	}
+	return resp.StatusCode
+}
+
+// location is the JSON representation of a location.
+type location struct {
+	Latitude  float64
+	Longitude float64
+	Accuracy  float64
+}
+
+// nextEvent reads the next event of the stream, skipping comments.
+func nextEvent(t *testing.T, r *bufio.Reader) (event string, loc location) {
+	t.Helper()
+	var data string
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("reading event: %v", err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case line == "" && event != "":
+			if err := json.Unmarshal([]byte(data), &loc); err != nil {
+				t.Fatalf("event data %q: %v", data, err)
+			}
+			return event, loc
+		case strings.HasPrefix(line, "event: "):
+			event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			data = strings.TrimPrefix(line, "data: ")
+		}
+	}
+}
+
+func TestHandler(t *testing.T) {
+	srv, gcm, cleanup := newManager(t)
+	defer cleanup()
+
+	handler := httpapi.NewHandler(gcm, "web", geoclue2.GClueAccuracyLevelCity)
+	ts := httptest.NewServer(handler)
+	defer ts.Close()
+
+	var errResponse map[string]string
+	if status := get(t, ts.URL+"/location", &errResponse); status != http.StatusServiceUnavailable {
+		t.Errorf("GET /location before Start: status %d, want %d", status, http.StatusServiceUnavailable)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := handler.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := handler.Start(ctx); !errors.Is(err, httpapi.ErrStarted) {
+		t.Errorf("second Start() = %v, want ErrStarted", err)
+	}
+	clients := srv.Clients()
+	if len(clients) != 1 || !clients[0].Active || clients[0].DesktopId != "web" ||
+		clients[0].RequestedAccuracyLevel != geoclue2.GClueAccuracyLevelCity {
+		t.Fatalf("clients %+v, want the started client of the handler", clients)
+	}
+
+	var status struct {
+		InUse                  bool
+		AvailableAccuracyLevel uint32
+		Active                 bool
+	}
+	srv.SetAvailableAccuracyLevel(geoclue2.GClueAccuracyLevelStreet)
+	if code := get(t, ts.URL+"/status", &status); code != http.StatusOK {
+		t.Fatalf("GET /status: status %d", code)
+	}
+	if !status.InUse || !status.Active || status.AvailableAccuracyLevel != uint32(geoclue2.GClueAccuracyLevelStreet) {
+		t.Errorf("GET /status = %+v", status)
+	}
+
+	// the event stream starts with the last location, once it is known
+	srv.SetLocation(geoclue2test.NewLocation(52.52, 13.40, 10))
+	var loc location
+	for deadline := time.Now().Add(timeout); ; time.Sleep(10 * time.Millisecond) {
+		code := get(t, ts.URL+"/location", &loc)
+		if code == http.StatusOK {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("GET /location: status %d", code)
+		}
+	}
+	if loc.Latitude != 52.52 || loc.Longitude != 13.40 || loc.Accuracy != 10 {
+		t.Errorf("GET /location = %+v", loc)
+	}
+
+	resp, err := http.Get(ts.URL + "/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("GET /events: Content-Type %s", ct)
+	}
+	events := bufio.NewReader(resp.Body)
+	if event, loc := nextEvent(t, events); event != "location" || loc.Latitude != 52.52 {
+		t.Errorf("first event %s %+v, want the last location", event, loc)
+	}
+	srv.SetLocation(geoclue2test.NewLocation(48.14, 11.58, 10))
+	if event, loc := nextEvent(t, events); event != "location" || loc.Latitude != 48.14 {
+		t.Errorf("event %s %+v, want the updated location", event, loc)
+	}
+
+	// Close ends the event streams and deletes the client
+	if err := handler.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := events.ReadString('\n'); err == nil {
+		t.Error("event stream not ended by Close()")
+	}
+	if clients := srv.Clients(); len(clients) != 0 {
+		t.Errorf("%d clients after Close(), want 0", len(clients))
+	}
+	if err := handler.Close(); !errors.Is(err, httpapi.ErrNotStarted) {
+		t.Errorf("second Close() = %v, want ErrNotStarted", err)
+	}
+}
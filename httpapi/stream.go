@@ -0,0 +1,186 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/maltegrosse/go-geoclue2"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// subscriberQueueSize is the number of pending locations per subscriber, further locations are dropped.
+const subscriberQueueSize = 8
+
+// Settings are the client properties requested by a consumer. Consumers with equal settings share a client.
+type Settings struct {
+	// The requested accuracy level, given by its name (e.g. "city") or numeric value in JSON.
+	AccuracyLevel geoclue2.GClueAccuracyLevel
+	// The distance threshold in meters, 0 for none.
+	DistanceThreshold uint32
+	// The time threshold in seconds, 0 for none.
+	TimeThreshold uint32
+}
+
+// UnmarshalJSON accepts the accuracy level by name or numeric value and rejects unknown levels.
+func (s *Settings) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		AccuracyLevel     json.RawMessage
+		DistanceThreshold uint32
+		TimeThreshold     uint32
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	level, err := parseAccuracyLevel(raw.AccuracyLevel)
+	if err != nil {
+		return err
+	}
+	*s = Settings{AccuracyLevel: level, DistanceThreshold: raw.DistanceThreshold, TimeThreshold: raw.TimeThreshold}
+	return nil
+}
+
+// parseAccuracyLevel parses a JSON string with the name or a JSON number with the value of an accuracy level.
+// A missing level or null is GClueAccuracyLevelExact.
+func parseAccuracyLevel(raw json.RawMessage) (geoclue2.GClueAccuracyLevel, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return geoclue2.GClueAccuracyLevelExact, nil
+	}
+	var name string
+	if err := json.Unmarshal(raw, &name); err == nil {
+		return geoclue2.ParseGClueAccuracyLevel(name)
+	}
+	var value uint32
+	if err := json.Unmarshal(raw, &value); err != nil {
+		return geoclue2.GClueAccuracyLevelNone, fmt.Errorf("invalid accuracy level %s", raw)
+	}
+	return geoclue2.ParseGClueAccuracyLevel(strconv.FormatUint(uint64(value), 10))
+}
+
+// MarshalJSON writes the accuracy level by name.
+func (s Settings) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]interface{}{
+		"AccuracyLevel":     strings.ToLower(s.AccuracyLevel.String()),
+		"DistanceThreshold": s.DistanceThreshold,
+		"TimeThreshold":     s.TimeThreshold,
+	})
+}
+
+// stream is a started client, whose location updates are fanned out to the subscribers.
+type stream struct {
+	client  geoclue2.GeoclueClientCloser
+	cancel  context.CancelFunc
+	onError func(error)
+
+	mu          sync.Mutex
+	last        *geoclue2.Location
+	subscribers map[chan geoclue2.Location]struct{}
+	closed      bool
+}
+
+// startStream opens a client with the given settings and watches its location updates.
+// The client is deleted again on failure.
+func startStream(ctx context.Context, manager geoclue2.GeoclueManager, desktopId string, settings Settings, onError func(error)) (*stream, error) {
+	client, err := manager.Open(ctx, geoclue2.ClientConfig{
+		DesktopId:              desktopId,
+		RequestedAccuracyLevel: settings.AccuracyLevel,
+		DistanceThreshold:      settings.DistanceThreshold,
+		TimeThreshold:          settings.TimeThreshold,
+	})
+	if err != nil {
+		return nil, err
+	}
+	watchCtx, cancel := context.WithCancel(context.Background())
+	s := &stream{
+		client:      client,
+		cancel:      cancel,
+		onError:     onError,
+		subscribers: make(map[chan geoclue2.Location]struct{}),
+	}
+	events, err := client.Watch(watchCtx)
+	if err != nil {
+		cancel()
+		_ = client.Close()
+		return nil, err
+	}
+	go s.watch(events)
+	return s, nil
+}
+
+// close stops and deletes the client, the subscriber channels are closed.
+func (s *stream) close() error {
+	s.cancel()
+	s.mu.Lock()
+	s.closeSubscribers()
+	s.mu.Unlock()
+	return s.client.Close()
+}
+
+// closeSubscribers must be called with mu held.
+func (s *stream) closeSubscribers() {
+	s.closed = true
+	for c := range s.subscribers {
+		close(c)
+	}
+	s.subscribers = make(map[chan geoclue2.Location]struct{})
+}
+
+func (s *stream) watch(events <-chan geoclue2.LocationEvent) {
+	defer func() {
+		s.mu.Lock()
+		s.closeSubscribers()
+		s.mu.Unlock()
+	}()
+	for event := range events {
+		if event.Err != nil {
+			if s.onError != nil {
+				s.onError(event.Err)
+			}
+			continue
+		}
+		location := event.New
+		s.mu.Lock()
+		s.last = &location
+		for c := range s.subscribers {
+			select {
+			case c <- location:
+			default:
+			}
+		}
+		s.mu.Unlock()
+	}
+}
+
+// lastLocation returns the last location, nil if none is known yet.
+func (s *stream) lastLocation() *geoclue2.Location {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.last
+}
+
+// subscribe returns a channel receiving the location updates, starting with the last location.
+// It is closed when the stream is closed.
+func (s *stream) subscribe() chan geoclue2.Location {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c := make(chan geoclue2.Location, subscriberQueueSize)
+	if s.closed {
+		close(c)
+		return c
+	}
+	if s.last != nil {
+		c <- *s.last
+	}
+	s.subscribers[c] = struct{}{}
+	return c
+}
+
+func (s *stream) unsubscribe(c chan geoclue2.Location) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.subscribers[c]; ok {
+		delete(s.subscribers, c)
+		close(c)
+	}
+}
@@ -0,0 +1,50 @@
+package httpapi_test
+
+import (
+	"encoding/json"
+	"github.com/maltegrosse/go-geoclue2"
+	"github.com/maltegrosse/go-geoclue2/httpapi"
+	"testing"
+)
+
+func TestSettingsUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		input string
+		want  httpapi.Settings
+	}{
+		{`{}`, httpapi.Settings{AccuracyLevel: geoclue2.GClueAccuracyLevelExact}},
+		{`{"AccuracyLevel": null}`, httpapi.Settings{AccuracyLevel: geoclue2.GClueAccuracyLevelExact}},
+		{`{"AccuracyLevel": "city", "DistanceThreshold": 10, "TimeThreshold": 60}`,
+			httpapi.Settings{AccuracyLevel: geoclue2.GClueAccuracyLevelCity, DistanceThreshold: 10, TimeThreshold: 60}},
+		{`{"AccuracyLevel": "Street"}`, httpapi.Settings{AccuracyLevel: geoclue2.GClueAccuracyLevelStreet}},
+		{`{"AccuracyLevel": "countr\u0079"}`, httpapi.Settings{AccuracyLevel: geoclue2.GClueAccuracyLevelCountry}},
+		{`{"AccuracyLevel": 5}`, httpapi.Settings{AccuracyLevel: geoclue2.GClueAccuracyLevelNeighborhood}},
+		{`{"AccuracyLevel": "8"}`, httpapi.Settings{AccuracyLevel: geoclue2.GClueAccuracyLevelExact}},
+	}
+	for _, test := range tests {
+		var settings httpapi.Settings
+		if err := json.Unmarshal([]byte(test.input), &settings); err != nil {
+			t.Errorf("%s: %v", test.input, err)
+			continue
+		}
+		if settings != test.want {
+			t.Errorf("%s: %+v, want %+v", test.input, settings, test.want)
+		}
+	}
+
+	for _, input := range []string{
+		`{"AccuracyLevel": "high"}`,
+		`{"AccuracyLevel": "\"city\""}`,
+		`{"AccuracyLevel": 3}`,
+		`{"AccuracyLevel": -1}`,
+		`{"AccuracyLevel": 1.5}`,
+		`{"AccuracyLevel": true}`,
+		`{"AccuracyLevel": ["city"]}`,
+		`{"DistanceThreshold": -1}`,
+	} {
+		var settings httpapi.Settings
+		if err := json.Unmarshal([]byte(input), &settings); err == nil {
+			t.Errorf("%s: unmarshaled to %+v without error", input, settings)
+		}
+	}
+}
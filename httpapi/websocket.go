@@ -0,0 +1,287 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/gorilla/websocket"
+	"github.com/maltegrosse/go-geoclue2"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// StartTimeout limits the D-Bus calls to create and start a client for new settings.
+	StartTimeout = 10 * time.Second
+
+	writeWait  = 10 * time.Second
+	pongWait   = 60 * time.Second
+	pingPeriod = pongWait * 9 / 10
+)
+
+// Message types sent by the WebSocketHandler.
+const (
+	MessageTypeSettings = "settings"
+	MessageTypeLocation = "location"
+	MessageTypeError    = "error"
+)
+
+// Message is sent by the WebSocketHandler as JSON text message. Depending on the type, either
+// the applied settings, a location or an error is set.
+type Message struct {
+	Type     string
+	Settings *Settings          `json:",omitempty"`
+	Location *geoclue2.Location `json:",omitempty"`
+	Error    string             `json:",omitempty"`
+}
+
+// errStreamClosed is sent when the client of a connection was closed by the handler.
+var errStreamClosed = errors.New("stream closed")
+
+// WebSocketHandler streams locations to WebSocket connections. Every connection sends its Settings as JSON
+// text message, e.g. {"AccuracyLevel": "city", "DistanceThreshold": 100, "TimeThreshold": 0}, and may send
+// new settings at any time. The handler confirms the settings with a "settings" message and then sends a
+// "location" message for every location update, starting with the last known location.
+//
+// Connections with equal settings share one GeoClue2 client, which is deleted when the last of them is closed.
+type WebSocketHandler struct {
+	// The desktop id of the clients, required by geoclue to authorize them.
+	DesktopId string
+	// Called for location updates which could not be read. May be nil.
+	OnError func(error)
+	// Upgrades the connections. By default, only same-origin requests are accepted, set CheckOrigin to allow others.
+	Upgrader websocket.Upgrader
+
+	manager geoclue2.GeoclueManager
+
+	mu      sync.Mutex
+	streams map[Settings]*sharedStream
+	closed  bool
+}
+
+// sharedStream is a stream with the number of connections using it. ready is closed once the client was
+// started, err is set if that failed.
+type sharedStream struct {
+	*stream
+	refs  int
+	ready chan struct{}
+	err   error
+}
+
+// NewWebSocketHandler returns a handler creating its clients with the given manager.
+func NewWebSocketHandler(manager geoclue2.GeoclueManager, desktopId string) *WebSocketHandler {
+	return &WebSocketHandler{
+		DesktopId: desktopId,
+		manager:   manager,
+		streams:   make(map[Settings]*sharedStream),
+	}
+}
+
+// Close stops and deletes all clients, which ends all connections. The handler can not be used afterwards.
+func (h *WebSocketHandler) Close() error {
+	h.mu.Lock()
+	streams := h.streams
+	h.streams = make(map[Settings]*sharedStream)
+	h.closed = true
+	h.mu.Unlock()
+	var err error
+	for _, s := range streams {
+		select {
+		case <-s.ready:
+		default:
+			// the stream is still starting, acquire closes it
+			continue
+		}
+		if cerr := s.close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// acquire returns the stream for the settings, starting a new client if there is none yet. The client is
+// started without holding h.mu, so other connections are not blocked by the D-Bus calls. Connections asking
+// for the same settings meanwhile wait for the pending stream, until it is started or ctx is done.
+func (h *WebSocketHandler) acquire(ctx context.Context, settings Settings) (*sharedStream, error) {
+	h.mu.Lock()
+	if h.closed {
+		h.mu.Unlock()
+		return nil, errStreamClosed
+	}
+	if s, ok := h.streams[settings]; ok {
+		s.refs++
+		h.mu.Unlock()
+		select {
+		case <-s.ready:
+		case <-ctx.Done():
+			h.release(settings, s)
+			return nil, ctx.Err()
+		}
+		if s.err != nil {
+			return nil, s.err
+		}
+		return s, nil
+	}
+	s := &sharedStream{refs: 1, ready: make(chan struct{})}
+	h.streams[settings] = s
+	h.mu.Unlock()
+
+	// the client is shared with the waiting connections, so it does not depend on the context of this one
+	startCtx, cancel := context.WithTimeout(context.Background(), StartTimeout)
+	started, err := startStream(startCtx, h.manager, h.DesktopId, settings, h.OnError)
+	cancel()
+
+	h.mu.Lock()
+	closed := h.closed
+	if err == nil && closed {
+		err = errStreamClosed
+	}
+	if err != nil {
+		if h.streams[settings] == s {
+			delete(h.streams, settings)
+		}
+		s.err = err
+	} else {
+		s.stream = started
+	}
+	close(s.ready)
+	h.mu.Unlock()
+	if err != nil {
+		if started != nil {
+			// Close() was called while the client was started
+			if cerr := started.close(); cerr != nil && h.OnError != nil {
+				h.OnError(cerr)
+			}
+		}
+		return nil, err
+	}
+	return s, nil
+}
+
+// release drops a reference to the stream of the settings, the client is deleted with the last one.
+func (h *WebSocketHandler) release(settings Settings, s *sharedStream) {
+	h.mu.Lock()
+	if h.streams[settings] != s {
+		// the stream was closed by Close()
+		h.mu.Unlock()
+		return
+	}
+	s.refs--
+	if s.refs > 0 {
+		h.mu.Unlock()
+		return
+	}
+	delete(h.streams, settings)
+	h.mu.Unlock()
+	if err := s.close(); err != nil && h.OnError != nil {
+		h.OnError(err)
+	}
+}
+
+// settingsRequest is a message received from a connection.
+type settingsRequest struct {
+	settings Settings
+	err      error
+}
+
+// ServeHTTP upgrades the connection and serves it until it is closed.
+func (h *WebSocketHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ws, err := h.Upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// the upgrader replied with an error already
+		return
+	}
+	defer ws.Close()
+
+	requests := make(chan settingsRequest)
+	done := make(chan struct{})
+	defer close(done)
+	go h.readLoop(ws, requests, done)
+
+	var (
+		current  *sharedStream
+		settings Settings
+		updates  chan geoclue2.Location
+	)
+	defer func() {
+		if current != nil {
+			current.unsubscribe(updates)
+			h.release(settings, current)
+		}
+	}()
+
+	ping := time.NewTicker(pingPeriod)
+	defer ping.Stop()
+	for {
+		var msg *Message
+		select {
+		case request, ok := <-requests:
+			if !ok {
+				return
+			}
+			if request.err != nil {
+				msg = &Message{Type: MessageTypeError, Error: request.err.Error()}
+				break
+			}
+			s, err := h.acquire(r.Context(), request.settings)
+			if err != nil {
+				msg = &Message{Type: MessageTypeError, Error: err.Error()}
+				break
+			}
+			// the new stream was acquired before the old one is released, so a client used by both is kept
+			if current != nil {
+				current.unsubscribe(updates)
+				h.release(settings, current)
+			}
+			current, settings = s, request.settings
+			updates = current.subscribe()
+			applied := settings
+			msg = &Message{Type: MessageTypeSettings, Settings: &applied}
+		case location, ok := <-updates:
+			if !ok {
+				_ = writeMessage(ws, Message{Type: MessageTypeError, Error: errStreamClosed.Error()})
+				return
+			}
+			msg = &Message{Type: MessageTypeLocation, Location: &location}
+		case <-ping.C:
+			_ = ws.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := ws.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+		if msg != nil {
+			if err := writeMessage(ws, *msg); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func writeMessage(ws *websocket.Conn, msg Message) error {
+	_ = ws.SetWriteDeadline(time.Now().Add(writeWait))
+	return ws.WriteJSON(msg)
+}
+
+// readLoop parses the settings sent by the connection, requests is closed when the connection is closed.
+func (h *WebSocketHandler) readLoop(ws *websocket.Conn, requests chan<- settingsRequest, done <-chan struct{}) {
+	defer close(requests)
+	_ = ws.SetReadDeadline(time.Now().Add(pongWait))
+	ws.SetPongHandler(func(string) error {
+		return ws.SetReadDeadline(time.Now().Add(pongWait))
+	})
+	for {
+		_, data, err := ws.ReadMessage()
+		if err != nil {
+			return
+		}
+		_ = ws.SetReadDeadline(time.Now().Add(pongWait))
+		var request settingsRequest
+		request.err = json.Unmarshal(data, &request.settings)
+		select {
+		case requests <- request:
+		case <-done:
+			return
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package httpapi_test
+
+import (
+	"errors"
+	"github.com/gorilla/websocket"
+	"github.com/maltegrosse/go-geoclue2"
+	"github.com/maltegrosse/go-geoclue2/geoclue2test"
+	"github.com/maltegrosse/go-geoclue2/httpapi"
+	"net/http/httptest"
+	"os/exec"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const timeout = 5 * time.Second
+
+func receive(t *testing.T, ws *websocket.Conn, msgType string) httpapi.Message {
+	t.Helper()
+	_ = ws.SetReadDeadline(time.Now().Add(timeout))
+	var msg httpapi.Message
+	if err := ws.ReadJSON(&msg); err != nil {
+		t.Fatalf("waiting for %s message: %v", msgType, err)
+	}
+	if msg.Type != msgType {
+		t.Fatalf("received %+v, want %s message", msg, msgType)
+	}
+	return msg
+}
+
+func TestWebSocketHandler(t *testing.T) {
+	bus, err := geoclue2test.NewBus()
+	if errors.Is(err, exec.ErrNotFound) {
+		t.Skip("dbus-daemon not found")
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bus.Close()
+	srvConn, err := bus.Dial()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srvConn.Close()
+	srv, err := geoclue2test.NewService(srvConn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := bus.Dial()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	gcm, err := geoclue2.NewGeoclueManager(geoclue2.WithConn(conn))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handler := httpapi.NewWebSocketHandler(gcm, "web")
+	ts := httptest.NewServer(handler)
+	defer ts.Close()
+	url := "ws" + strings.TrimPrefix(ts.URL, "http")
+
+	// connect concurrently, the connections with equal settings share the client started by the first of them
+	requests := []string{
+		`{"AccuracyLevel": "city"}`,
+		`{"AccuracyLevel": "city"}`,
+		`{"AccuracyLevel": "city"}`,
+		`{"AccuracyLevel": "exact", "DistanceThreshold": 10}`,
+	}
+	conns := make([]*websocket.Conn, len(requests))
+	var wg sync.WaitGroup
+	for i, request := range requests {
+		ws, _, err := websocket.DefaultDialer.Dial(url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer ws.Close()
+		conns[i] = ws
+		wg.Add(1)
+		go func(ws *websocket.Conn, request string) {
+			defer wg.Done()
+			_ = ws.WriteMessage(websocket.TextMessage, []byte(request))
+		}(ws, request)
+	}
+	wg.Wait()
+	for _, ws := range conns {
+		receive(t, ws, httpapi.MessageTypeSettings)
+	}
+	clients := srv.Clients()
+	if len(clients) != 2 {
+		t.Fatalf("%d clients, want 2: %+v", len(clients), clients)
+	}
+	for _, client := range clients {
+		if !client.Active || client.DesktopId != "web" {
+			t.Errorf("client %+v not started", client)
+		}
+	}
+
+	srv.SetLocation(geoclue2test.NewLocation(52.52, 13.40, 10))
+	for _, ws := range conns {
+		msg := receive(t, ws, httpapi.MessageTypeLocation)
+		if msg.Location == nil || msg.Location.Latitude != 52.52 {
+			t.Errorf("location message %+v", msg)
+		}
+	}
+
+	// the client is deleted with the last connection using it
+	conns[3].Close()
+	deadline := time.Now().Add(timeout)
+	for len(srv.Clients()) != 1 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if clients := srv.Clients(); len(clients) != 1 {
+		t.Errorf("%d clients after closing the only connection of a client, want 1", len(clients))
+	}
+
+	if err := handler.Close(); err != nil {
+		t.Fatal(err)
+	}
+	for _, ws := range conns[:3] {
+		msg := receive(t, ws, httpapi.MessageTypeError)
+		if msg.Error != "stream closed" {
+			t.Errorf("error message %+v", msg)
+		}
+	}
+	if clients := srv.Clients(); len(clients) != 0 {
+		t.Errorf("%d clients after Close(), want 0", len(clients))
+	}
+}
@@ -0,0 +1,78 @@
+package nmea
+
+import (
+	"context"
+	"errors"
+	"github.com/godbus/dbus/v5"
+	"sync"
+)
+
+// ServiceType is the DNS-SD service type of NMEA 0183 over TCP, which geoclue's network NMEA source discovers.
+const ServiceType = "_nmea-0183._tcp"
+
+const (
+	avahiDestination         = "org.freedesktop.Avahi"
+	avahiServerInterface     = avahiDestination + ".Server"
+	avahiEntryGroupInterface = avahiDestination + ".EntryGroup"
+	avahiObjectPath          = "/"
+
+	avahiMethodEntryGroupNew = avahiServerInterface + ".EntryGroupNew"
+	avahiMethodAddService    = avahiEntryGroupInterface + ".AddService"
+	avahiMethodCommit        = avahiEntryGroupInterface + ".Commit"
+	avahiMethodFree          = avahiEntryGroupInterface + ".Free"
+
+	avahiIfUnspec    = int32(-1)
+	avahiProtoUnspec = int32(-1)
+)
+
+// ErrAdvertisementClosed is returned by Advertisement.Close if it was already closed.
+var ErrAdvertisementClosed = errors.New("nmea: advertisement closed")
+
+// Advertisement is a service published via mDNS/DNS-SD by the Avahi daemon.
+// Avahi withdraws it as well when the D-Bus connection is closed.
+type Advertisement struct {
+	group dbus.BusObject
+
+	mu     sync.Mutex
+	closed bool
+}
+
+// Advertise publishes a ServiceType service with the given instance name and TCP port on all interfaces
+// via the Avahi daemon. If conn is nil, the system bus is used. The name must be unique in the network,
+// e.g. include the host name.
+func Advertise(ctx context.Context, conn *dbus.Conn, name string, port uint16) (*Advertisement, error) {
+	if conn == nil {
+		var err error
+		conn, err = dbus.SystemBus()
+		if err != nil {
+			return nil, err
+		}
+	}
+	var groupPath dbus.ObjectPath
+	err := conn.Object(avahiDestination, avahiObjectPath).CallWithContext(ctx, avahiMethodEntryGroupNew, 0).Store(&groupPath)
+	if err != nil {
+		return nil, err
+	}
+	group := conn.Object(avahiDestination, groupPath)
+	err = group.CallWithContext(ctx, avahiMethodAddService, 0,
+		avahiIfUnspec, avahiProtoUnspec, uint32(0), name, ServiceType, "", "", port, [][]byte{}).Err
+	if err == nil {
+		err = group.CallWithContext(ctx, avahiMethodCommit, 0).Err
+	}
+	if err != nil {
+		_ = group.Call(avahiMethodFree, 0).Err
+		return nil, err
+	}
+	return &Advertisement{group: group}, nil
+}
+
+// Close withdraws the service.
+func (a *Advertisement) Close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.closed {
+		return ErrAdvertisementClosed
+	}
+	a.closed = true
+	return a.group.Call(avahiMethodFree, 0).Err
+}
@@ -0,0 +1,127 @@
+// Package nmea generates NMEA 0183 sentences from GeoClue2 locations.
+//
+// The GGA, RMC and VTG sentences are generated with the "GP" talker id. Unknown values (altitude, speed
+// and heading) are left blank. Sentences are returned without the trailing "\r\n".
+//
+// Server broadcasts the sentences over TCP and Advertise publishes it via Avahi as _nmea-0183._tcp service,
+// so geoclue instances on other machines in the network can use it as network NMEA source.
+package nmea
+
+import (
+	"fmt"
+	"github.com/maltegrosse/go-geoclue2"
+	"math"
+	"strings"
+)
+
+// Talker is the talker id used for all sentences.
+const Talker = "GP"
+
+// UERE is the assumed user equivalent range error in meters, used to estimate the HDOP of the GGA sentence
+// from the accuracy of the location, as geoclue does not provide the dilution of precision.
+const UERE = 5.0
+
+const (
+	knotsPerMeterPerSecond = 3600.0 / 1852.0
+	kmhPerMeterPerSecond   = 3.6
+)
+
+// Checksum returns the checksum of a sentence: the XOR of all characters between '$' and '*'.
+// The leading '$' and everything from '*' on are ignored, if present.
+func Checksum(sentence string) byte {
+	sentence = strings.TrimPrefix(sentence, "$")
+	if idx := strings.IndexByte(sentence, '*'); idx != -1 {
+		sentence = sentence[:idx]
+	}
+	var checksum byte
+	for i := 0; i < len(sentence); i++ {
+		checksum ^= sentence[i]
+	}
+	return checksum
+}
+
+// sentence joins the fields and adds the talker id and checksum.
+func sentence(formatter string, fields ...string) string {
+	body := Talker + formatter + "," + strings.Join(fields, ",")
+	return fmt.Sprintf("$%s*%02X", body, Checksum(body))
+}
+
+// formatCoordinate formats a coordinate as (d)ddmm.mmmmm and its hemisphere.
+func formatCoordinate(value float64, degreeDigits int, positive, negative string) (string, string) {
+	hemisphere := positive
+	if value < 0 {
+		hemisphere = negative
+		value = -value
+	}
+	// round the minutes first, so that 59.999999 minutes become the next degree
+	minutes := math.Round(value*60*1e5) / 1e5
+	degrees := math.Floor(minutes / 60)
+	minutes -= degrees * 60
+	return fmt.Sprintf("%0*d%08.5f", degreeDigits, int(degrees), minutes), hemisphere
+}
+
+func formatFloat(value float64, ok bool, precision int) string {
+	if !ok {
+		return ""
+	}
+	return fmt.Sprintf("%.*f", precision, value)
+}
+
+func formatTime(l geoclue2.Location) string {
+	t := l.Timestamp.UTC()
+	return fmt.Sprintf("%02d%02d%02d.%02d", t.Hour(), t.Minute(), t.Second(), t.Nanosecond()/1e7)
+}
+
+// GGA returns the Global Positioning System Fix Data sentence. The HDOP is estimated from the accuracy (see UERE).
+func GGA(l geoclue2.Location) string {
+	lat, ns := formatCoordinate(l.Latitude, 2, "N", "S")
+	lon, ew := formatCoordinate(l.Longitude, 3, "E", "W")
+	altitudeUnit := ""
+	if l.HasAltitude() {
+		altitudeUnit = "M"
+	}
+	return sentence("GGA",
+		formatTime(l),
+		lat, ns,
+		lon, ew,
+		"1", // GPS fix
+		"",  // number of satellites
+		formatFloat(l.Accuracy/UERE, l.Accuracy > 0, 1),
+		formatFloat(l.Altitude, l.HasAltitude(), 1), altitudeUnit,
+		"", "", // geoid separation
+		"", "", // DGPS age and station id
+	)
+}
+
+// RMC returns the Recommended Minimum Specific GNSS Data sentence.
+func RMC(l geoclue2.Location) string {
+	lat, ns := formatCoordinate(l.Latitude, 2, "N", "S")
+	lon, ew := formatCoordinate(l.Longitude, 3, "E", "W")
+	return sentence("RMC",
+		formatTime(l),
+		"A", // valid
+		lat, ns,
+		lon, ew,
+		formatFloat(l.Speed*knotsPerMeterPerSecond, l.HasSpeed(), 1),
+		formatFloat(l.Heading, l.HasHeading(), 1),
+		l.Timestamp.UTC().Format("020106"),
+		"", "", // magnetic variation
+		"A", // autonomous mode
+	)
+}
+
+// VTG returns the Course Over Ground and Ground Speed sentence.
+func VTG(l geoclue2.Location) string {
+	return sentence("VTG",
+		formatFloat(l.Heading, l.HasHeading(), 1), "T",
+		"", "M", // magnetic course
+		formatFloat(l.Speed*knotsPerMeterPerSecond, l.HasSpeed(), 1), "N",
+		formatFloat(l.Speed*kmhPerMeterPerSecond, l.HasSpeed(), 1), "K",
+		"A", // autonomous mode
+	)
+}
+
+// Sentences returns the GGA, RMC and VTG sentences for the location.
+func Sentences(l geoclue2.Location) []string {
+	return []string{GGA(l), RMC(l), VTG(l)}
+}
@@ -0,0 +1,109 @@
+package nmea_test
+
+import (
+	"fmt"
+	"github.com/maltegrosse/go-geoclue2"
+	"github.com/maltegrosse/go-geoclue2/nmea"
+	"strings"
+	"testing"
+	"time"
+)
+
+var (
+	timestamp = time.Date(2020, 9, 13, 12, 35, 19, 0, time.UTC)
+
+	// north east of the equator and Greenwich, with altitude, speed and heading
+	munich = geoclue2.Location{
+		Latitude:  48.1173,
+		Longitude: 11.516666666666667,
+		Accuracy:  4.5,
+		Altitude:  545.4,
+		Speed:     10,
+		Heading:   84.4,
+		Timestamp: timestamp,
+	}
+	// south west of the equator and Greenwich, without altitude, speed and heading
+	santiago = geoclue2.Location{
+		Latitude:  -33.4489,
+		Longitude: -70.6693,
+		Accuracy:  25,
+		Altitude:  geoclue2.UnknownAltitude,
+		Speed:     geoclue2.UnknownSpeed,
+		Heading:   geoclue2.UnknownHeading,
+		Timestamp: timestamp.Add(250 * time.Millisecond),
+	}
+)
+
+func TestChecksum(t *testing.T) {
+	tests := []struct {
+		sentence string
+		want     byte
+	}{
+		{"$GPGGA,123519,4807.038,N,01131.000,E,1,08,0.9,545.4,M,46.9,M,,*47", 0x47},
+		{"GPGGA,123519,4807.038,N,01131.000,E,1,08,0.9,545.4,M,46.9,M,,", 0x47},
+		{"$GPVTG,,T,,M,,N,,K,A*23", 0x23},
+		{"", 0},
+	}
+	for _, test := range tests {
+		if got := nmea.Checksum(test.sentence); got != test.want {
+			t.Errorf("Checksum(%q) = %02X, want %02X", test.sentence, got, test.want)
+		}
+	}
+}
+
+func TestSentences(t *testing.T) {
+	tests := []struct {
+		name     string
+		generate func(geoclue2.Location) string
+		location geoclue2.Location
+		want     string
+	}{
+		{"GGA", nmea.GGA, munich, "$GPGGA,123519.00,4807.03800,N,01131.00000,E,1,,0.9,545.4,M,,,,*39"},
+		{"RMC", nmea.RMC, munich, "$GPRMC,123519.00,A,4807.03800,N,01131.00000,E,19.4,84.4,130920,,,A*5C"},
+		{"VTG", nmea.VTG, munich, "$GPVTG,84.4,T,,M,19.4,N,36.0,K,A*3C"},
+		{"GGA unknown altitude", nmea.GGA, santiago, "$GPGGA,123519.25,3326.93400,S,07040.15800,W,1,,5.0,,,,,,*59"},
+		{"RMC unknown speed and heading", nmea.RMC, santiago, "$GPRMC,123519.25,A,3326.93400,S,07040.15800,W,,,130920,,,A*57"},
+		{"VTG unknown speed and heading", nmea.VTG, santiago, "$GPVTG,,T,,M,,N,,K,A*23"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := test.generate(test.location)
+			if got != test.want {
+				t.Errorf("got  %s\nwant %s", got, test.want)
+			}
+			idx := strings.LastIndexByte(got, '*')
+			if idx == -1 {
+				t.Fatalf("%s has no checksum", got)
+			}
+			if checksum := fmt.Sprintf("%02X", nmea.Checksum(got)); got[idx+1:] != checksum {
+				t.Errorf("%s: checksum %s does not match", got, checksum)
+			}
+		})
+	}
+}
+
+func TestCoordinateRounding(t *testing.T) {
+	// 59.999999 minutes are rounded to the next degree instead of 60 minutes
+	l := munich
+	l.Latitude = 47.99999999
+	l.Longitude = -11.99999999
+	fields := strings.Split(nmea.GGA(l), ",")
+	if fields[2] != "4800.00000" || fields[3] != "N" {
+		t.Errorf("latitude %s %s, want 4800.00000 N", fields[2], fields[3])
+	}
+	if fields[4] != "01200.00000" || fields[5] != "W" {
+		t.Errorf("longitude %s %s, want 01200.00000 W", fields[4], fields[5])
+	}
+}
+
+func TestSentencesOrder(t *testing.T) {
+	sentences := nmea.Sentences(munich)
+	if len(sentences) != 3 {
+		t.Fatalf("%d sentences, want 3", len(sentences))
+	}
+	for i, prefix := range []string{"$GPGGA,", "$GPRMC,", "$GPVTG,"} {
+		if !strings.HasPrefix(sentences[i], prefix) {
+			t.Errorf("sentence %d = %s, want prefix %s", i, sentences[i], prefix)
+		}
+	}
+}
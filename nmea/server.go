@@ -0,0 +1,232 @@
+package nmea
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/maltegrosse/go-geoclue2"
+	"io"
+	"io/ioutil"
+	"net"
+	"strings"
+	"sync"
+)
+
+// DefaultAddress listens on the IANA registered nmea-0183 port on all interfaces.
+const DefaultAddress = ":10110"
+
+// queueSize is the number of pending updates per connection, a connection is closed if it is exceeded.
+const queueSize = 32
+
+// ErrServerClosed is returned by Serve after Close was called.
+var ErrServerClosed = errors.New("nmea: server closed")
+
+// Server broadcasts the locations of a GeoclueClient as NMEA sentences to all TCP connections, like the
+// network NMEA sources geoclue itself consumes. New connections receive the last known location right away.
+// The client is not started by the server.
+type Server struct {
+	// Called for location updates which could not be read and failed connections. May be nil.
+	OnError func(error)
+
+	client geoclue2.GeoclueClient
+
+	mu       sync.Mutex
+	last     []byte
+	conns    map[*conn]struct{}
+	listener net.Listener
+	closed   bool
+	watching bool
+}
+
+// NewServer returns a server for the locations of client.
+func NewServer(client geoclue2.GeoclueClient) *Server {
+	return &Server{client: client, conns: make(map[*conn]struct{})}
+}
+
+// ListenAndServe listens on the TCP address addr, DefaultAddress if empty, and calls Serve.
+func (s *Server) ListenAndServe(ctx context.Context, addr string) error {
+	if addr == "" {
+		addr = DefaultAddress
+	}
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(ctx, l)
+}
+
+// Watch subscribes to the location updates of the client until ctx is done. Serve calls it, if it was not
+// called before. Call it before the client is started, to not miss the first location.
+func (s *Server) Watch(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.watching {
+		return nil
+	}
+	events, err := s.client.Watch(ctx)
+	if err != nil {
+		return err
+	}
+	s.watching = true
+	go s.watch(events)
+	return nil
+}
+
+// Serve accepts connections on l until ctx is done or Close is called. The listener is closed on return.
+func (s *Server) Serve(ctx context.Context, l net.Listener) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		_ = l.Close()
+		return ErrServerClosed
+	}
+	s.listener = l
+	s.mu.Unlock()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	if err := s.Watch(ctx); err != nil {
+		_ = l.Close()
+		return err
+	}
+	go func() {
+		<-ctx.Done()
+		_ = l.Close()
+	}()
+
+	for {
+		c, err := l.Accept()
+		if err != nil {
+			s.closeConns()
+			s.mu.Lock()
+			closed := s.closed
+			s.mu.Unlock()
+			if closed {
+				return ErrServerClosed
+			}
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+		s.serveConn(c)
+	}
+}
+
+// Close closes the listener and all connections.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	l := s.listener
+	s.mu.Unlock()
+	s.closeConns()
+	if l != nil {
+		return l.Close()
+	}
+	return nil
+}
+
+func (s *Server) onError(err error) {
+	if s.OnError != nil {
+		s.OnError(err)
+	}
+}
+
+func (s *Server) watch(events <-chan geoclue2.LocationEvent) {
+	defer func() {
+		s.mu.Lock()
+		s.watching = false
+		s.mu.Unlock()
+	}()
+	for event := range events {
+		if event.Err != nil {
+			s.onError(event.Err)
+			continue
+		}
+		update := []byte(strings.Join(Sentences(event.New), "\r\n") + "\r\n")
+		s.mu.Lock()
+		s.last = update
+		conns := make([]*conn, 0, len(s.conns))
+		for c := range s.conns {
+			conns = append(conns, c)
+		}
+		s.mu.Unlock()
+		for _, c := range conns {
+			c.send(update)
+		}
+	}
+}
+
+func (s *Server) serveConn(nc net.Conn) {
+	c := &conn{s: s, nc: nc, queue: make(chan []byte, queueSize), done: make(chan struct{})}
+	s.mu.Lock()
+	// queue the last update while registering the connection, so it can't overtake a newer broadcast.
+	// The queue is empty, so this does not block.
+	if s.last != nil {
+		c.queue <- s.last
+	}
+	s.conns[c] = struct{}{}
+	s.mu.Unlock()
+	go c.writeLoop()
+	go c.readLoop()
+}
+
+func (s *Server) closeConns() {
+	s.mu.Lock()
+	conns := s.conns
+	s.conns = make(map[*conn]struct{})
+	s.mu.Unlock()
+	for c := range conns {
+		c.close()
+	}
+}
+
+// conn is a single client connection.
+type conn struct {
+	s     *Server
+	nc    net.Conn
+	queue chan []byte
+	done  chan struct{}
+	once  sync.Once
+}
+
+func (c *conn) close() {
+	c.once.Do(func() {
+		close(c.done)
+		_ = c.nc.Close()
+		c.s.mu.Lock()
+		delete(c.s.conns, c)
+		c.s.mu.Unlock()
+	})
+}
+
+// send queues an update, the connection is closed if the client does not keep up.
+func (c *conn) send(update []byte) {
+	select {
+	case c.queue <- update:
+	case <-c.done:
+	default:
+		c.s.onError(fmt.Errorf("nmea: closing slow connection %v", c.nc.RemoteAddr()))
+		c.close()
+	}
+}
+
+func (c *conn) writeLoop() {
+	for {
+		select {
+		case update := <-c.queue:
+			if _, err := c.nc.Write(update); err != nil {
+				c.close()
+				return
+			}
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// readLoop discards the input, to notice when the peer closes the connection.
+func (c *conn) readLoop() {
+	defer c.close()
+	_, _ = io.Copy(ioutil.Discard, c.nc)
+}
@@ -0,0 +1,115 @@
+package nmea_test
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"github.com/maltegrosse/go-geoclue2"
+	"github.com/maltegrosse/go-geoclue2/geoclue2test"
+	"github.com/maltegrosse/go-geoclue2/nmea"
+	"net"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+)
+
+const timeout = 5 * time.Second
+
+// listener is a connection to a server.
+type listener struct {
+	t      *testing.T
+	nc     net.Conn
+	reader *bufio.Reader
+}
+
+func dial(t *testing.T, addr string) *listener {
+	t.Helper()
+	nc, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &listener{t: t, nc: nc, reader: bufio.NewReader(nc)}
+}
+
+// expect reads the sentences of an update and compares them with the sentences of the location.
+func (l *listener) expect(location geoclue2.Location) {
+	l.t.Helper()
+	l.nc.SetReadDeadline(time.Now().Add(timeout))
+	for _, want := range nmea.Sentences(location) {
+		line, err := l.reader.ReadString('\n')
+		if err != nil {
+			l.t.Fatalf("waiting for %s: %v", want, err)
+		}
+		if !strings.HasSuffix(line, "\r\n") {
+			l.t.Errorf("%q is not terminated by CR LF", line)
+		}
+		if got := strings.TrimSuffix(line, "\r\n"); got != want {
+			l.t.Errorf("got  %s\nwant %s", got, want)
+		}
+	}
+}
+
+func TestServer(t *testing.T) {
+	bus, err := geoclue2test.NewBus()
+	if errors.Is(err, exec.ErrNotFound) {
+		t.Skip("dbus-daemon not found")
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bus.Close()
+	srvConn, err := bus.Dial()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srvConn.Close()
+	srv, err := geoclue2test.NewService(srvConn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := bus.Dial()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	gcm, err := geoclue2.NewGeoclueManager(geoclue2.WithConn(conn))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	client, err := gcm.Open(ctx, geoclue2.ClientConfig{DesktopId: "nmea", RequestedAccuracyLevel: geoclue2.GClueAccuracyLevelExact})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	server := nmea.NewServer(client)
+	if err := server.Watch(ctx); err != nil {
+		t.Fatal(err)
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	go server.Serve(ctx, l)
+
+	first := dial(t, l.Addr().String())
+	defer first.nc.Close()
+	berlin := geoclue2test.NewLocation(52.52, 13.40, 10)
+	srv.SetLocation(berlin)
+	first.expect(geoclue2.Location(berlin))
+
+	// a new connection receives the last sentences right away
+	second := dial(t, l.Addr().String())
+	defer second.nc.Close()
+	second.expect(geoclue2.Location(berlin))
+
+	// updates are broadcast to all connections
+	santiago := geoclue2test.NewLocation(-33.4489, -70.6693, 25)
+	srv.SetLocation(santiago)
+	first.expect(geoclue2.Location(santiago))
+	second.expect(geoclue2.Location(santiago))
+}
@@ -0,0 +1,29 @@
+package geoclue2
+
+import "github.com/godbus/dbus/v5"
+
+// Option configures the D-Bus connection used by a GeoClue2 object.
+type Option func(*options)
+
+type options struct {
+	conn *dbus.Conn
+}
+
+// WithConn uses the given connection instead of the shared system bus connection. This allows talking to
+// GeoClue2 on a session bus, a private connection or a test bus. Objects created by another object
+// (e.g. a client returned by GetClient()) inherit the connection of their parent.
+func WithConn(conn *dbus.Conn) Option {
+	return func(o *options) {
+		o.conn = conn
+	}
+}
+
+func newOptions(opts []Option) options {
+	var o options
+	for _, opt := range opts {
+		if opt != nil {
+			opt(&o)
+		}
+	}
+	return o
+}
@@ -0,0 +1,372 @@
+package geoclue2
+
+import (
+	"github.com/godbus/dbus/v5"
+	"strings"
+	"sync"
+)
+
+const (
+	dbusInterface               = "org.freedesktop.DBus"
+	dbusObjectPath              = "/org/freedesktop/DBus"
+	dbusSignalNameOwnerChanged  = "NameOwnerChanged"
+	dbusSignalPropertiesChanged = "PropertiesChanged"
+)
+
+// signalFilter selects the signals a subscriber is interested in. Empty fields match everything.
+type signalFilter struct {
+	// The well-known or unique bus name of the sender, signals are matched against its current owner.
+	sender string
+	path   dbus.ObjectPath
+	iface  string
+	member string
+	// The first argument of the signal, if it is a string.
+	arg0 string
+}
+
+func (f signalFilter) matchOptions() []dbus.MatchOption {
+	var options []dbus.MatchOption
+	if f.sender != "" {
+		options = append(options, dbus.WithMatchSender(f.sender))
+	}
+	if f.path != "" {
+		options = append(options, dbus.WithMatchObjectPath(f.path))
+	}
+	if f.iface != "" {
+		options = append(options, dbus.WithMatchInterface(f.iface))
+	}
+	if f.member != "" {
+		options = append(options, dbus.WithMatchMember(f.member))
+	}
+	if f.arg0 != "" {
+		options = append(options, dbus.WithMatchOption("arg0", f.arg0))
+	}
+	return options
+}
+
+// rule returns the match rule as string, used as key for reference counting.
+func (f signalFilter) rule() string {
+	var items []string
+	for _, item := range []struct{ key, value string }{
+		{"sender", f.sender}, {"path", string(f.path)}, {"interface", f.iface}, {"member", f.member}, {"arg0", f.arg0},
+	} {
+		if item.value != "" {
+			items = append(items, item.key+"='"+item.value+"'")
+		}
+	}
+	return strings.Join(items, ",")
+}
+
+func (f signalFilter) matches(v *dbus.Signal, owner string) bool {
+	if f.sender != "" && v.Sender != owner {
+		return false
+	}
+	if f.path != "" && v.Path != f.path {
+		return false
+	}
+	idx := strings.LastIndex(v.Name, ".")
+	if idx == -1 {
+		return false
+	}
+	if f.iface != "" && v.Name[:idx] != f.iface {
+		return false
+	}
+	if f.member != "" && v.Name[idx+1:] != f.member {
+		return false
+	}
+	if f.arg0 != "" {
+		if len(v.Body) == 0 {
+			return false
+		}
+		if arg0, ok := v.Body[0].(string); !ok || arg0 != f.arg0 {
+			return false
+		}
+	}
+	return true
+}
+
+// maxQueuedSignals limits the signals queued for a subscription, whose receiver does not keep up.
+// When the limit is reached, the oldest signal is dropped.
+const maxQueuedSignals = 1024
+
+// signalSubscription receives the signals matching its filter on C. C is closed when the subscription is
+// closed or the connection is closed. The signals are queued per subscription and sent on C by its own
+// goroutine, so a receiver which does not keep up does not block the other subscriptions of the connection.
+type signalSubscription struct {
+	C <-chan *dbus.Signal
+
+	d      *signalDispatcher
+	filter signalFilter
+	c      chan *dbus.Signal
+	done   chan struct{}
+	exited chan struct{}
+	once   sync.Once
+
+	mu     sync.Mutex
+	queue  []*dbus.Signal
+	queued chan struct{}
+}
+
+// deliver queues the signal without blocking the dispatcher.
+func (s *signalSubscription) deliver(v *dbus.Signal) {
+	s.mu.Lock()
+	if len(s.queue) == maxQueuedSignals {
+		s.queue[0] = nil
+		s.queue = s.queue[1:]
+	}
+	s.queue = append(s.queue, v)
+	s.mu.Unlock()
+	select {
+	case s.queued <- struct{}{}:
+	default:
+	}
+}
+
+// run sends the queued signals on C until the subscription is closed, then closes C.
+func (s *signalSubscription) run() {
+	defer close(s.exited)
+	defer close(s.c)
+	for {
+		s.mu.Lock()
+		if len(s.queue) == 0 {
+			s.mu.Unlock()
+			select {
+			case <-s.queued:
+				continue
+			case <-s.done:
+				return
+			}
+		}
+		v := s.queue[0]
+		s.queue[0] = nil
+		s.queue = s.queue[1:]
+		s.mu.Unlock()
+		select {
+		case s.c <- v:
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// Close removes the subscription and closes C. It is safe to call Close multiple times and from any goroutine.
+func (s *signalSubscription) Close() {
+	s.once.Do(func() {
+		close(s.done)
+		s.d.remove(s)
+		<-s.exited
+	})
+}
+
+// signalDispatcher receives all signals of a connection in a single goroutine and fans them out to the registered
+// subscriptions. Match rules are reference counted, so each rule is added to the bus once per connection and
+// removed when its last subscription is closed. The owners of sender names are tracked with NameOwnerChanged,
+// so signals of a restarted service are still delivered.
+type signalDispatcher struct {
+	conn    *dbus.Conn
+	sigChan chan *dbus.Signal
+
+	mu            sync.Mutex
+	subscriptions map[*signalSubscription]struct{}
+	owners        map[string]string
+	terminated    bool
+
+	rulesMu sync.Mutex
+	rules   map[string]int
+}
+
+var (
+	dispatchersMu sync.Mutex
+	dispatchers   = make(map[*dbus.Conn]*signalDispatcher)
+)
+
+// getDispatcher returns the dispatcher of the connection, starting it on first use.
+func getDispatcher(conn *dbus.Conn) *signalDispatcher {
+	dispatchersMu.Lock()
+	defer dispatchersMu.Unlock()
+	d, ok := dispatchers[conn]
+	if !ok {
+		d = &signalDispatcher{
+			conn:          conn,
+			sigChan:       make(chan *dbus.Signal, 64),
+			subscriptions: make(map[*signalSubscription]struct{}),
+			owners:        make(map[string]string),
+			rules:         make(map[string]int),
+		}
+		dispatchers[conn] = d
+		conn.Signal(d.sigChan)
+		go d.run()
+	}
+	return d
+}
+
+func (d *signalDispatcher) run() {
+	for v := range d.sigChan {
+		d.mu.Lock()
+		if v.Sender == dbusInterface && v.Name == dbusInterface+"."+dbusSignalNameOwnerChanged && len(v.Body) == 3 {
+			name, _ := v.Body[0].(string)
+			newOwner, _ := v.Body[2].(string)
+			if _, ok := d.owners[name]; ok {
+				d.owners[name] = newOwner
+			}
+		}
+		var matching []*signalSubscription
+		for s := range d.subscriptions {
+			if s.filter.matches(v, d.owner(s.filter.sender)) {
+				matching = append(matching, s)
+			}
+		}
+		d.mu.Unlock()
+		for _, s := range matching {
+			s.deliver(v)
+		}
+	}
+
+	// the connection was closed
+	dispatchersMu.Lock()
+	delete(dispatchers, d.conn)
+	dispatchersMu.Unlock()
+	d.mu.Lock()
+	d.terminated = true
+	subscriptions := d.subscriptions
+	d.subscriptions = make(map[*signalSubscription]struct{})
+	d.mu.Unlock()
+	for s := range subscriptions {
+		s.Close()
+	}
+}
+
+// owner returns the unique name owning the sender name. d.mu must be held.
+func (d *signalDispatcher) owner(sender string) string {
+	if !isWellKnownName(sender) {
+		return sender
+	}
+	return d.owners[sender]
+}
+
+// isWellKnownName reports whether name is a well-known bus name, whose owner can change.
+func isWellKnownName(name string) bool {
+	return name != "" && name != dbusInterface && !strings.HasPrefix(name, ":")
+}
+
+// subscribe adds a subscription for the filter.
+func (d *signalDispatcher) subscribe(filter signalFilter) (*signalSubscription, error) {
+	err := d.addRule(filter)
+	if err != nil {
+		return nil, err
+	}
+	if isWellKnownName(filter.sender) {
+		err = d.trackOwner(filter.sender)
+		if err != nil {
+			d.removeRule(filter)
+			return nil, err
+		}
+	}
+
+	c := make(chan *dbus.Signal, 10)
+	s := &signalSubscription{
+		C:      c,
+		d:      d,
+		filter: filter,
+		c:      c,
+		done:   make(chan struct{}),
+		exited: make(chan struct{}),
+		queued: make(chan struct{}, 1),
+	}
+	d.mu.Lock()
+	if d.terminated {
+		d.mu.Unlock()
+		d.removeRule(filter)
+		return nil, dbus.ErrClosed
+	}
+	d.subscriptions[s] = struct{}{}
+	d.mu.Unlock()
+	go s.run()
+	return s, nil
+}
+
+func (d *signalDispatcher) remove(s *signalSubscription) {
+	d.mu.Lock()
+	_, ok := d.subscriptions[s]
+	delete(d.subscriptions, s)
+	d.mu.Unlock()
+	if ok {
+		d.removeRule(s.filter)
+		if isWellKnownName(s.filter.sender) {
+			d.removeRule(ownerFilter(s.filter.sender))
+		}
+	}
+}
+
+func ownerFilter(name string) signalFilter {
+	return signalFilter{
+		sender: dbusInterface,
+		path:   dbusObjectPath,
+		iface:  dbusInterface,
+		member: dbusSignalNameOwnerChanged,
+		arg0:   name,
+	}
+}
+
+// trackOwner subscribes to owner changes of the well-known name and reads its current owner on first use.
+// The NameOwnerChanged rule is reference counted with the subscriptions using the name.
+func (d *signalDispatcher) trackOwner(name string) error {
+	d.rulesMu.Lock()
+	defer d.rulesMu.Unlock()
+	filter := ownerFilter(name)
+	rule := filter.rule()
+	if d.rules[rule] == 0 {
+		err := d.conn.AddMatchSignal(filter.matchOptions()...)
+		if err != nil {
+			return makeError(err)
+		}
+	}
+	// the rule may be used by a plain NameOwnerChanged subscription, which does not track the owner
+	d.mu.Lock()
+	_, tracked := d.owners[name]
+	d.mu.Unlock()
+	if !tracked {
+		var owner string
+		err := d.conn.BusObject().Call(dbusMethodGetNameOwner, 0, name).Store(&owner)
+		if err != nil {
+			// the service is not running (yet), its owner is set by NameOwnerChanged
+			owner = ""
+		}
+		d.mu.Lock()
+		d.owners[name] = owner
+		d.mu.Unlock()
+	}
+	d.rules[rule]++
+	return nil
+}
+
+func (d *signalDispatcher) addRule(filter signalFilter) error {
+	d.rulesMu.Lock()
+	defer d.rulesMu.Unlock()
+	rule := filter.rule()
+	if d.rules[rule] == 0 {
+		err := d.conn.AddMatchSignal(filter.matchOptions()...)
+		if err != nil {
+			return makeError(err)
+		}
+	}
+	d.rules[rule]++
+	return nil
+}
+
+func (d *signalDispatcher) removeRule(filter signalFilter) {
+	d.rulesMu.Lock()
+	defer d.rulesMu.Unlock()
+	rule := filter.rule()
+	d.rules[rule]--
+	if d.rules[rule] > 0 {
+		return
+	}
+	delete(d.rules, rule)
+	d.conn.RemoveMatchSignal(filter.matchOptions()...)
+	if filter.member == dbusSignalNameOwnerChanged && filter.sender == dbusInterface {
+		d.mu.Lock()
+		delete(d.owners, filter.arg0)
+		d.mu.Unlock()
+	}
+}
@@ -0,0 +1,132 @@
+package geoclue2_test
+
+import (
+	"context"
+	"github.com/maltegrosse/go-geoclue2"
+	"github.com/maltegrosse/go-geoclue2/geoclue2test"
+	"sync"
+	"testing"
+)
+
+// TestWatchNotStarved checks that a subscriber, which does not read its events, does not block the
+// delivery of signals to the other subscribers of the same connection.
+func TestWatchNotStarved(t *testing.T) {
+	f := newFake(t)
+	defer f.close()
+	gcm := f.manager(t)
+
+	ctx, cancel := contextWithTimeout()
+	defer cancel()
+	var clients []geoclue2.GeoclueClient
+	var events []<-chan geoclue2.LocationEvent
+	for _, desktopId := range []string{"stalled", "reading"} {
+		gcc := newClient(t, gcm, desktopId)
+		c, err := gcc.Watch(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		clients = append(clients, gcc)
+		events = append(events, c)
+	}
+	for _, gcc := range clients {
+		if err := gcc.Start(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	const updates = 40
+	for i := 1; i <= updates; i++ {
+		f.srv.SetLocation(geoclue2test.NewLocation(float64(i), 0, 10))
+		select {
+		case event := <-events[1]:
+			if event.Err != nil {
+				t.Fatal(event.Err)
+			}
+			if event.New.Latitude != float64(i) {
+				t.Fatalf("event %d: latitude %v, want %d", i, event.New.Latitude, i)
+			}
+		case <-ctx.Done():
+			t.Fatalf("received %d of %d events", i-1, updates)
+		}
+	}
+}
+
+// TestSubscribeConcurrently subscribes and closes subscriptions of one connection from many goroutines, the match
+// rules and tracked owners must be released with the last subscription. Run it with -race.
+func TestSubscribeConcurrently(t *testing.T) {
+	f := newFake(t)
+	defer f.close()
+	conn := f.dial(t)
+	gcm, err := geoclue2.NewGeoclueManager(geoclue2.WithConn(conn))
+	if err != nil {
+		t.Fatal(err)
+	}
+	gcc := newClient(t, gcm, "concurrent")
+
+	// a subscription, which stays open while the others come and go
+	ctx, cancel := contextWithTimeout()
+	defer cancel()
+	events, err := gcc.Watch(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rules, owners := geoclue2.DispatcherState(conn)
+	if len(rules) != 2 || len(owners) != 1 {
+		t.Fatalf("rules %v and owners %v with one subscription, want the signal rule and the owner of the service", rules, owners)
+	}
+
+	const goroutines, rounds = 20, 10
+	var wg sync.WaitGroup
+	errs := make(chan error, goroutines)
+	for i := 0; i < goroutines; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < rounds; j++ {
+				ctx, cancel := context.WithCancel(context.Background())
+				var c interface{}
+				var err error
+				switch (i + j) % 3 {
+				case 0:
+					c, err = gcc.Watch(ctx)
+				case 1:
+					c, err = gcc.WatchActive(ctx)
+				default:
+					c, err = gcm.WatchProperties(ctx)
+				}
+				cancel()
+				if err != nil {
+					errs <- err
+					return
+				}
+				// the channels are closed after their subscription is closed
+				switch c := c.(type) {
+				case <-chan geoclue2.LocationEvent:
+					for range c {
+					}
+				case <-chan geoclue2.ActiveEvent:
+					for range c {
+					}
+				case <-chan geoclue2.ManagerEvent:
+					for range c {
+					}
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+
+	if rules, owners := geoclue2.DispatcherState(conn); len(rules) != 2 || len(owners) != 1 {
+		t.Errorf("rules %v and owners %v after closing the other subscriptions, want those of the open subscription", rules, owners)
+	}
+	cancel()
+	for range events {
+	}
+	if rules, owners := geoclue2.DispatcherState(conn); len(rules) != 0 || len(owners) != 0 {
+		t.Errorf("rules %v and owners %v after closing all subscriptions, want none", rules, owners)
+	}
+}
@@ -1,9 +1,11 @@
 package geoclue2
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"github.com/godbus/dbus/v5"
+	"strings"
 	"time"
 )
 
@@ -30,7 +32,15 @@ import (
 */
 
 const (
-	dbusMethodAddMatch = "org.freedesktop.DBus.AddMatch"
+	dbusMethodAddMatch     = "org.freedesktop.DBus.AddMatch"
+	dbusMethodGetNameOwner = "org.freedesktop.DBus.GetNameOwner"
+
+	dbusIntrospectableInterface = "org.freedesktop.DBus.Introspectable"
+
+	dbusPropertiesInterface = "org.freedesktop.DBus.Properties"
+	dbusMethodGet           = dbusPropertiesInterface + ".Get"
+	dbusMethodGetAll        = dbusPropertiesInterface + ".GetAll"
+	dbusMethodSet           = dbusPropertiesInterface + ".Set"
 )
 
 type dbusBase struct {
@@ -38,12 +48,15 @@ type dbusBase struct {
 	obj  dbus.BusObject
 }
 
-func (d *dbusBase) init(iface string, objectPath dbus.ObjectPath) error {
-	var err error
-
-	d.conn, err = dbus.SystemBus()
-	if err != nil {
-		return err
+func (d *dbusBase) init(iface string, objectPath dbus.ObjectPath, opts ...Option) error {
+	o := newOptions(opts)
+	d.conn = o.conn
+	if d.conn == nil {
+		var err error
+		d.conn, err = dbus.SystemBus()
+		if err != nil {
+			return err
+		}
 	}
 
 	d.obj = d.conn.Object(iface, objectPath)
@@ -51,41 +64,69 @@ func (d *dbusBase) init(iface string, objectPath dbus.ObjectPath) error {
 	return nil
 }
 
-func (d *dbusBase) call(method string, args ...interface{}) error {
-	return d.obj.Call(method, 0, args...).Err
+func (d *dbusBase) call(ctx context.Context, method string, args ...interface{}) error {
+	return makeError(d.obj.CallWithContext(ctx, method, 0, args...).Err)
+}
+
+func (d *dbusBase) callWithReturn(ctx context.Context, ret interface{}, method string, args ...interface{}) error {
+	return makeError(d.obj.CallWithContext(ctx, method, 0, args...).Store(ret))
 }
 
-func (d *dbusBase) callWithReturn(ret interface{}, method string, args ...interface{}) error {
-	return d.obj.Call(method, 0, args...).Store(ret)
+func (d *dbusBase) callWithReturn2(ctx context.Context, ret1 interface{}, ret2 interface{}, method string, args ...interface{}) error {
+	return makeError(d.obj.CallWithContext(ctx, method, 0, args...).Store(ret1, ret2))
 }
 
-func (d *dbusBase) callWithReturn2(ret1 interface{}, ret2 interface{}, method string, args ...interface{}) error {
-	return d.obj.Call(method, 0, args...).Store(ret1, ret2)
+// ObjectPath returns the D-Bus object path of the object.
+func (d *dbusBase) ObjectPath() dbus.ObjectPath {
+	return d.obj.Path()
 }
 
-func (d *dbusBase) subscribe(iface, member string) {
-	rule := fmt.Sprintf("type='signal',interface='%s',path='%s',member='%s'",
-		iface, d.obj.Path(), GeoclueInterface)
-	d.conn.BusObject().Call(dbusMethodAddMatch, 0, rule)
+// subscribeSignal subscribes to the signal emitted by the service for this object.
+func (d *dbusBase) subscribeSignal(iface, member string) (*signalSubscription, error) {
+	return getDispatcher(d.conn).subscribe(signalFilter{
+		sender: d.obj.Destination(),
+		path:   d.obj.Path(),
+		iface:  iface,
+		member: member,
+	})
 }
 
-func (d *dbusBase) subscribeNamespace(namespace string) {
-	rule := fmt.Sprintf("type='signal',path_namespace='%s'", namespace)
-	d.conn.BusObject().Call(dbusMethodAddMatch, 0, rule)
+// splitProperty splits a property in interface.member notation into its interface and member name.
+func splitProperty(property string) (iface string, name string, err error) {
+	idx := strings.LastIndex(property, ".")
+	if idx == -1 || idx+1 == len(property) {
+		err = fmt.Errorf("invalid property '%s'", property)
+		return
+	}
+	return property[:idx], property[idx+1:], nil
 }
 
-func (d *dbusBase) getProperty(iface string) (interface{}, error) {
-	variant, err := d.obj.GetProperty(iface)
+func (d *dbusBase) getProperty(ctx context.Context, iface string) (interface{}, error) {
+	pIface, pName, err := splitProperty(iface)
+	if err != nil {
+		return nil, err
+	}
+	var variant dbus.Variant
+	err = d.callWithReturn(ctx, &variant, dbusMethodGet, pIface, pName)
 	return variant.Value(), err
 }
 
-func (d *dbusBase) setProperty(iface string, value interface{}) error {
-	err := d.obj.SetProperty(iface, dbus.MakeVariant(value))
-	return err
+func (d *dbusBase) getAllProperties(ctx context.Context, iface string) (map[string]dbus.Variant, error) {
+	var props map[string]dbus.Variant
+	err := d.callWithReturn(ctx, &props, dbusMethodGetAll, iface)
+	return props, err
 }
 
-func (d *dbusBase) getObjectProperty(iface string) (value dbus.ObjectPath, err error) {
-	prop, err := d.getProperty(iface)
+func (d *dbusBase) setProperty(ctx context.Context, iface string, value interface{}) error {
+	pIface, pName, err := splitProperty(iface)
+	if err != nil {
+		return err
+	}
+	return d.call(ctx, dbusMethodSet, pIface, pName, dbus.MakeVariant(value))
+}
+
+func (d *dbusBase) getObjectProperty(ctx context.Context, iface string) (value dbus.ObjectPath, err error) {
+	prop, err := d.getProperty(ctx, iface)
 	if err != nil {
 		return
 	}
@@ -97,8 +138,8 @@ func (d *dbusBase) getObjectProperty(iface string) (value dbus.ObjectPath, err e
 	return
 }
 
-func (d *dbusBase) getSliceObjectProperty(iface string) (value []dbus.ObjectPath, err error) {
-	prop, err := d.getProperty(iface)
+func (d *dbusBase) getSliceObjectProperty(ctx context.Context, iface string) (value []dbus.ObjectPath, err error) {
+	prop, err := d.getProperty(ctx, iface)
 	if err != nil {
 		return
 	}
@@ -110,8 +151,8 @@ func (d *dbusBase) getSliceObjectProperty(iface string) (value []dbus.ObjectPath
 	return
 }
 
-func (d *dbusBase) getBoolProperty(iface string) (value bool, err error) {
-	prop, err := d.getProperty(iface)
+func (d *dbusBase) getBoolProperty(ctx context.Context, iface string) (value bool, err error) {
+	prop, err := d.getProperty(ctx, iface)
 	if err != nil {
 		return
 	}
@@ -123,8 +164,8 @@ func (d *dbusBase) getBoolProperty(iface string) (value bool, err error) {
 	return
 }
 
-func (d *dbusBase) getStringProperty(iface string) (value string, err error) {
-	prop, err := d.getProperty(iface)
+func (d *dbusBase) getStringProperty(ctx context.Context, iface string) (value string, err error) {
+	prop, err := d.getProperty(ctx, iface)
 	if err != nil {
 		return
 	}
@@ -136,8 +177,8 @@ func (d *dbusBase) getStringProperty(iface string) (value string, err error) {
 	return
 }
 
-func (d *dbusBase) getSliceStringProperty(iface string) (value []string, err error) {
-	prop, err := d.getProperty(iface)
+func (d *dbusBase) getSliceStringProperty(ctx context.Context, iface string) (value []string, err error) {
+	prop, err := d.getProperty(ctx, iface)
 	if err != nil {
 		return
 	}
@@ -149,8 +190,8 @@ func (d *dbusBase) getSliceStringProperty(iface string) (value []string, err err
 	return
 }
 
-func (d *dbusBase) getSliceSliceByteProperty(iface string) (value [][]byte, err error) {
-	prop, err := d.getProperty(iface)
+func (d *dbusBase) getSliceSliceByteProperty(ctx context.Context, iface string) (value [][]byte, err error) {
+	prop, err := d.getProperty(ctx, iface)
 	if err != nil {
 		return
 	}
@@ -162,8 +203,8 @@ func (d *dbusBase) getSliceSliceByteProperty(iface string) (value [][]byte, err
 	return
 }
 
-func (d *dbusBase) getMapStringVariantProperty(iface string) (value map[string]dbus.Variant, err error) {
-	prop, err := d.getProperty(iface)
+func (d *dbusBase) getMapStringVariantProperty(ctx context.Context, iface string) (value map[string]dbus.Variant, err error) {
+	prop, err := d.getProperty(ctx, iface)
 	if err != nil {
 		return
 	}
@@ -174,42 +215,37 @@ func (d *dbusBase) getMapStringVariantProperty(iface string) (value map[string]d
 	}
 	return
 }
-func (d *dbusBase) getTimestampProperty(iface string) (value time.Time, err error) {
-	prop, err := d.getProperty(iface)
+func (d *dbusBase) getTimestampProperty(ctx context.Context, iface string) (value time.Time, err error) {
+	prop, err := d.getProperty(ctx, iface)
 	if err != nil {
 		return
 	}
+	return parseTimestamp(iface, prop)
+}
+
+// parseTimestamp parses the (tt) representation of a timestamp: seconds and microseconds since the Epoch.
+func parseTimestamp(iface string, prop interface{}) (value time.Time, err error) {
 	parsedValue, ok := prop.([]interface{})
+	if !ok || len(parsedValue) != 2 {
+		err = makeErrVariantType(iface)
+		return
+	}
+	sec, ok := parsedValue[0].(uint64)
 	if !ok {
 		err = makeErrVariantType(iface)
 		return
 	}
-	var sec uint64
-	sec = 0
-	var msec uint64
-	msec = 0
-	for idx, val := range parsedValue {
-		if idx == 0 {
-			sec, ok = val.(uint64)
-			if !ok {
-				err = makeErrVariantType(iface)
-				return
-			}
-		}
-		if idx == 1 {
-			msec, ok = val.(uint64)
-			if !ok {
-				err = makeErrVariantType(iface)
-				return
-			}
-		}
+	usec, ok := parsedValue[1].(uint64)
+	if !ok {
+		err = makeErrVariantType(iface)
+		return
 	}
-	value = time.Unix(int64(sec), int64(msec))
+	value = time.Unix(int64(sec), int64(usec)*int64(time.Microsecond))
 	return
 }
 
-func (d *dbusBase) getUint8Property(iface string) (value uint8, err error) {
-	prop, err := d.getProperty(iface)
+func (d *dbusBase) getUint8Property(ctx context.Context, iface string) (value uint8, err error) {
+	prop, err := d.getProperty(ctx, iface)
 	if err != nil {
 		return
 	}
@@ -221,8 +257,8 @@ func (d *dbusBase) getUint8Property(iface string) (value uint8, err error) {
 	return
 }
 
-func (d *dbusBase) getUint32Property(iface string) (value uint32, err error) {
-	prop, err := d.getProperty(iface)
+func (d *dbusBase) getUint32Property(ctx context.Context, iface string) (value uint32, err error) {
+	prop, err := d.getProperty(ctx, iface)
 	if err != nil {
 		return
 	}
@@ -234,8 +270,8 @@ func (d *dbusBase) getUint32Property(iface string) (value uint32, err error) {
 	return
 }
 
-func (d *dbusBase) getInt64Property(iface string) (value int64, err error) {
-	prop, err := d.getProperty(iface)
+func (d *dbusBase) getInt64Property(ctx context.Context, iface string) (value int64, err error) {
+	prop, err := d.getProperty(ctx, iface)
 	if err != nil {
 		return
 	}
@@ -246,8 +282,8 @@ func (d *dbusBase) getInt64Property(iface string) (value int64, err error) {
 	}
 	return
 }
-func (d *dbusBase) getFloat32Property(iface string) (value float32, err error) {
-	prop, err := d.getProperty(iface)
+func (d *dbusBase) getFloat32Property(ctx context.Context, iface string) (value float32, err error) {
+	prop, err := d.getProperty(ctx, iface)
 	if err != nil {
 		return
 	}
@@ -259,8 +295,8 @@ func (d *dbusBase) getFloat32Property(iface string) (value float32, err error) {
 	return
 }
 
-func (d *dbusBase) getFloat64Property(iface string) (value float64, err error) {
-	prop, err := d.getProperty(iface)
+func (d *dbusBase) getFloat64Property(ctx context.Context, iface string) (value float64, err error) {
+	prop, err := d.getProperty(ctx, iface)
 	if err != nil {
 		return
 	}
@@ -272,8 +308,8 @@ func (d *dbusBase) getFloat64Property(iface string) (value float64, err error) {
 	return
 }
 
-func (d *dbusBase) getUint64Property(iface string) (value uint64, err error) {
-	prop, err := d.getProperty(iface)
+func (d *dbusBase) getUint64Property(ctx context.Context, iface string) (value uint64, err error) {
+	prop, err := d.getProperty(ctx, iface)
 	if err != nil {
 		return
 	}
@@ -285,8 +321,8 @@ func (d *dbusBase) getUint64Property(iface string) (value uint64, err error) {
 	return
 }
 
-func (d *dbusBase) getSliceUint32Property(iface string) (value []uint32, err error) {
-	prop, err := d.getProperty(iface)
+func (d *dbusBase) getSliceUint32Property(ctx context.Context, iface string) (value []uint32, err error) {
+	prop, err := d.getProperty(ctx, iface)
 	if err != nil {
 		return
 	}
@@ -298,8 +334,8 @@ func (d *dbusBase) getSliceUint32Property(iface string) (value []uint32, err err
 	return
 }
 
-func (d *dbusBase) getSliceSliceUint32Property(iface string) (value [][]uint32, err error) {
-	prop, err := d.getProperty(iface)
+func (d *dbusBase) getSliceSliceUint32Property(ctx context.Context, iface string) (value [][]uint32, err error) {
+	prop, err := d.getProperty(ctx, iface)
 	if err != nil {
 		return
 	}
@@ -311,8 +347,8 @@ func (d *dbusBase) getSliceSliceUint32Property(iface string) (value [][]uint32,
 	return
 }
 
-func (d *dbusBase) getSliceMapStringVariantProperty(iface string) (value []map[string]dbus.Variant, err error) {
-	prop, err := d.getProperty(iface)
+func (d *dbusBase) getSliceMapStringVariantProperty(ctx context.Context, iface string) (value []map[string]dbus.Variant, err error) {
+	prop, err := d.getProperty(ctx, iface)
 	if err != nil {
 		return
 	}
@@ -324,8 +360,8 @@ func (d *dbusBase) getSliceMapStringVariantProperty(iface string) (value []map[s
 	return
 }
 
-func (d *dbusBase) getSliceByteProperty(iface string) (value []byte, err error) {
-	prop, err := d.getProperty(iface)
+func (d *dbusBase) getSliceByteProperty(ctx context.Context, iface string) (value []byte, err error) {
+	prop, err := d.getProperty(ctx, iface)
 	if err != nil {
 		return
 	}
@@ -0,0 +1,36 @@
+package geoclue2
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseTimestamp(t *testing.T) {
+	tests := []struct {
+		name    string
+		prop    interface{}
+		want    time.Time
+		wantErr bool
+	}{
+		{"whole seconds", []interface{}{uint64(1600000000), uint64(0)}, time.Unix(1600000000, 0), false},
+		{"microseconds", []interface{}{uint64(1600000000), uint64(123456)}, time.Unix(1600000000, 123456000), false},
+		{"epoch", []interface{}{uint64(0), uint64(0)}, time.Unix(0, 0), false},
+		{"one field", []interface{}{uint64(1600000000)}, time.Time{}, true},
+		{"three fields", []interface{}{uint64(1600000000), uint64(0), uint64(0)}, time.Time{}, true},
+		{"signed seconds", []interface{}{int64(1600000000), uint64(0)}, time.Time{}, true},
+		{"signed microseconds", []interface{}{uint64(1600000000), int64(0)}, time.Time{}, true},
+		{"no slice", uint64(1600000000), time.Time{}, true},
+		{"nil", nil, time.Time{}, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := parseTimestamp(GeoclueLocationPropertyTimestamp, test.prop)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("parseTimestamp(%#v) error = %v, wantErr %v", test.prop, err, test.wantErr)
+			}
+			if !got.Equal(test.want) {
+				t.Errorf("parseTimestamp(%#v) = %v, want %v", test.prop, got, test.want)
+			}
+		})
+	}
+}